@@ -0,0 +1,103 @@
+package squashfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Files first read within this amount of time of each other are ordered by how often they're read.
+const accessWindow = 100 * time.Millisecond
+
+// A regular file that was read while access recording was enabled.
+type FileAccess struct {
+	Path  string
+	First time.Time // When the file was first read.
+	Count int       // The number of times the file was opened and read.
+}
+
+// Shared between copies of a Reader.
+type accessLog struct {
+	enabled atomic.Bool
+	mut     sync.Mutex
+	files   map[string]*FileAccess
+}
+
+func (a *accessLog) record(p string) {
+	if a == nil || !a.enabled.Load() {
+		return
+	}
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if acc, has := a.files[p]; has {
+		acc.Count++
+		return
+	}
+	a.files[p] = &FileAccess{Path: p, First: time.Now(), Count: 1}
+}
+
+// Starts or stops recording which regular files are read. Recorded accesses can be used to create a mksquashfs sort file with WriteSortFile.
+// Previously recorded accesses are kept when recording is stopped.
+func (r *Reader) RecordAccess(enable bool) {
+	r.access.enabled.Store(enable)
+}
+
+// Returns the recorded file accesses, in the order they were first read.
+func (r *Reader) AccessLog() []FileAccess {
+	r.access.mut.Lock()
+	out := make([]FileAccess, 0, len(r.access.files))
+	for _, acc := range r.access.files {
+		out = append(out, *acc)
+	}
+	r.access.mut.Unlock()
+	slices.SortFunc(out, func(a, b FileAccess) int {
+		return a.First.Compare(b.First)
+	})
+	return out
+}
+
+// Writes a sort file for mksquashfs's -sort option from the recorded file accesses, so a rebuilt archive
+// stores the recorded files first and in the order they're used. prefix is added to the start of each path, and
+// should be set to the source directory's name if mksquashfs is given multiple sources.
+//
+// Files are given priorities in the order they were first read, from 32767 down to 1. Files first read at nearly
+// the same time are ordered by how often they were read. Files that weren't read keep mksquashfs's default priority of 0.
+func (r *Reader) WriteSortFile(w io.Writer, prefix string) error {
+	acc := r.AccessLog()
+	if len(acc) == 0 {
+		return nil
+	}
+	start := acc[0].First
+	slices.SortStableFunc(acc, func(a, b FileAccess) int {
+		aWin, bWin := a.First.Sub(start)/accessWindow, b.First.Sub(start)/accessWindow
+		if aWin < bWin {
+			return -1
+		} else if aWin > bWin {
+			return 1
+		}
+		return b.Count - a.Count
+	})
+	bw := bufio.NewWriter(w)
+	priority := 32767
+	for _, a := range acc {
+		// Newlines can't be represented in a sort file.
+		if strings.Contains(a.Path, "\n") {
+			continue
+		}
+		fmt.Fprintf(bw, "%s %d\n", escapeSortPath(prefix+a.Path), priority)
+		priority = max(priority-1, 1)
+	}
+	return bw.Flush()
+}
+
+// mksquashfs allows whitespace in sort file paths if it's escaped with a backslash.
+var sortPathEscaper = strings.NewReplacer(`\`, `\\`, " ", `\ `, "\t", "\\\t")
+
+func escapeSortPath(p string) string {
+	return sortPathEscaper.Replace(p)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+func diff(args []string) {
+	set := flag.NewFlagSet("diff", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs diff [flags] old-archive new-archive")
+		fmt.Fprintln(set.Output(), "Lists the files added (+), removed (-), and changed (~) between two archives.")
+		set.PrintDefaults()
+	}
+	oldOffset := set.Int64("o", 0, "Offset of the old archive")
+	newOffset := set.Int64("no", 0, "Offset of the new archive")
+	ignore := set.String("ignore", "", "Comma separated changes to ignore. Any of type, content, mode, owner, mtime, target, device, and xattr")
+	dir := set.String("d", "", "Only compare this directory")
+	quiet := set.Bool("q", false, "Don't list the differences, only set the exit status")
+	routines := set.Int("j", 0, "The number of files to hash at once. Defaults to the number of CPUs")
+	set.Parse(args)
+	if set.NArg() < 2 {
+		set.Usage()
+		os.Exit(0)
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	op := squashfs.DiffOptions{Routines: *routines}
+	if *ignore != "" {
+		var err error
+		op.Ignore, err = squashfs.ParseChangeKind(*ignore)
+		if err != nil {
+			fail(err)
+		}
+	}
+	oldRdr := openReader(set.Arg(0), *oldOffset)
+	newRdr := openReader(set.Arg(1), *newOffset)
+	oldFS, newFS := oldRdr.FS, newRdr.FS
+	if *dir != "" && *dir != "." {
+		sub, err := oldRdr.Sub(*dir)
+		if err != nil {
+			fail(err)
+		}
+		oldFS = sub.(squashfs.FS)
+		sub, err = newRdr.Sub(*dir)
+		if err != nil {
+			fail(err)
+		}
+		newFS = sub.(squashfs.FS)
+	}
+	diffs, err := oldFS.Diff(newFS, op)
+	if err != nil {
+		fail(err)
+	}
+	if !*quiet {
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	squashfslow "github.com/CalebQ42/squashfs/low"
+)
+
+func humanSize(size uint64, human bool) string {
+	if !human {
+		return strconv.FormatUint(size, 10)
+	}
+	units := []string{"B", "K", "M", "G", "T"}
+	val := float64(size)
+	i := 0
+	for val >= 1024 && i < len(units)-1 {
+		val /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(size, 10) + units[0]
+	}
+	return strconv.FormatFloat(val, 'f', 1, 64) + units[i]
+}
+
+func du(args []string) {
+	set := flag.NewFlagSet("du", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs du [flags] archive")
+		fmt.Fprintln(set.Output(), "Shows the compressed and uncompressed size of directories in the archive.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	all := set.Bool("a", false, "Show files as well as directories")
+	depth := set.Int("d", -1, "Only show entries up to this depth")
+	human := set.Bool("h", false, "Human readable sizes")
+	sortBy := set.String("sort", "", "Sort by disk, size, blocks, or name. Defaults to the archive's order")
+	reverse := set.Bool("r", false, "Reverse the sort order")
+	totals := set.Bool("totals", false, "Show archive wide totals")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(0)
+	}
+	r := openReader(set.Arg(0), *offset)
+	usage, err := r.Low.Usage()
+	if err != nil {
+		panic(err)
+	}
+	type row struct {
+		path   string
+		disk   uint64
+		size   uint64
+		blocks uint32
+		frag   string
+	}
+	var rows []row
+	for _, d := range usage.Dirs {
+		rows = append(rows, row{path: d.Path, disk: d.DiskSize, size: d.Size, blocks: d.Blocks})
+	}
+	if *all {
+		for _, f := range usage.Files {
+			if f.HardLink {
+				continue
+			}
+			fr := row{path: f.Path, disk: f.DiskSize, size: f.Size, blocks: f.Blocks}
+			if f.HasFragment() {
+				fr.frag = "frag " + strconv.FormatUint(uint64(f.FragIndex), 10)
+			}
+			if f.UncompressedBlocks > 0 {
+				fr.frag = strings.TrimSpace(fr.frag + " " + strconv.FormatUint(uint64(f.UncompressedBlocks), 10) + " uncompressed")
+			}
+			rows = append(rows, fr)
+		}
+	}
+	if *depth >= 0 {
+		rows = slices.DeleteFunc(rows, func(r row) bool {
+			if r.path == "." {
+				return false
+			}
+			return strings.Count(r.path, "/")+1 > *depth
+		})
+	}
+	if *sortBy == "" && *all {
+		*sortBy = "name"
+	}
+	switch *sortBy {
+	case "disk":
+		slices.SortStableFunc(rows, func(a, b row) int { return compareUint(b.disk, a.disk) })
+	case "size":
+		slices.SortStableFunc(rows, func(a, b row) int { return compareUint(b.size, a.size) })
+	case "blocks":
+		slices.SortStableFunc(rows, func(a, b row) int { return compareUint(uint64(b.blocks), uint64(a.blocks)) })
+	case "name":
+		slices.SortStableFunc(rows, func(a, b row) int {
+			return slices.Compare(strings.Split(a.path, "/"), strings.Split(b.path, "/"))
+		})
+	case "":
+	default:
+		fmt.Println("Invalid sort:", *sortBy)
+		os.Exit(1)
+	}
+	if *reverse {
+		slices.Reverse(rows)
+	}
+	for _, r := range rows {
+		fmt.Printf("%10s %10s %8d %s", humanSize(r.disk, *human), humanSize(r.size, *human), r.blocks, r.path)
+		if r.frag != "" {
+			fmt.Printf(" (%s)", r.frag)
+		}
+		fmt.Println()
+	}
+	if *totals {
+		t := usage.Totals
+		fmt.Println()
+		fmt.Println("Archive size:     ", humanSize(t.ArchiveSize, *human))
+		fmt.Println("Uncompressed data:", humanSize(t.Size, *human))
+		fmt.Println("Data blocks:      ", humanSize(t.Data, *human))
+		fmt.Println("Fragments:        ", humanSize(t.Fragments, *human))
+		fmt.Println("Metadata:         ", humanSize(t.Metadata, *human))
+		for typ := squashfslow.SuperblockRegion; typ <= squashfslow.XattrTableRegion; typ++ {
+			if size, ok := t.Regions[typ]; ok && typ != squashfslow.DataRegion && typ != squashfslow.FragmentRegion {
+				fmt.Printf("  %-20s %s\n", typ.String()+":", humanSize(size, *human))
+			}
+		}
+	}
+}
+
+func compareUint(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
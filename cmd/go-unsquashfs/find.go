@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+// Parses sizes such as 512, 10K, or 1.5G.
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	if i := strings.IndexAny(s, "KkMmGgTt"); i == len(s)-1 && i > 0 {
+		switch s[i] {
+		case 'K', 'k':
+			mult = 1024
+		case 'M', 'm':
+			mult = 1024 * 1024
+		case 'G', 'g':
+			mult = 1024 * 1024 * 1024
+		case 'T', 't':
+			mult = 1024 * 1024 * 1024 * 1024
+		}
+		s = s[:i]
+	}
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(val * float64(mult)), nil
+}
+
+// Parses times as either RFC3339 or a date (2006-01-02) in the local timezone.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func parseIds(s string) ([]uint32, error) {
+	var out []uint32
+	for _, id := range strings.Split(s, ",") {
+		val, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id: %s", id)
+		}
+		out = append(out, uint32(val))
+	}
+	return out, nil
+}
+
+func parseTypes(s string) (squashfs.FileType, error) {
+	var out squashfs.FileType
+	for _, c := range s {
+		switch c {
+		case 'f':
+			out |= squashfs.TypeRegular
+		case 'd':
+			out |= squashfs.TypeDir
+		case 'l':
+			out |= squashfs.TypeSymlink
+		case 'b', 'c':
+			out |= squashfs.TypeDevice
+		case 'p':
+			out |= squashfs.TypeFifo
+		case 's':
+			out |= squashfs.TypeSocket
+		case ',':
+		default:
+			return 0, fmt.Errorf("invalid type: %c", c)
+		}
+	}
+	return out, nil
+}
+
+func find(args []string) {
+	set := flag.NewFlagSet("find", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs find [flags] archive [directory]")
+		fmt.Fprintln(set.Output(), "Lists the files in the archive that match all the given flags. Only the archive's metadata is read.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	name := set.String("name", "", "Only match file names matching the pattern")
+	pathPattern := set.String("path", "", "Only match paths matching the pattern. ** matches any number of directories")
+	types := set.String("type", "", "Only match the given types. Any of f (regular), d, l, b or c (device), p (fifo), and s")
+	minSize := set.String("min-size", "", "Only match files of at least this size, such as 10K or 1.5M")
+	maxSize := set.String("max-size", "", "Only match files of at most this size")
+	empty := set.Bool("empty", false, "Only match empty files and directories")
+	after := set.String("newer", "", "Only match files modified at or after this time (RFC3339 or 2006-01-02)")
+	before := set.String("older", "", "Only match files modified before this time (RFC3339 or 2006-01-02)")
+	uids := set.String("uid", "", "Only match files owned by one of these comma separated uids")
+	gids := set.String("gid", "", "Only match files owned by one of these comma separated gids")
+	perm := set.String("perm", "", "Only match files with all of these octal permission bits set. Prefix with / to match any of the bits")
+	minLinks := set.Uint("min-links", 0, "Only match files with at least this many hard links")
+	maxLinks := set.Uint("max-links", 0, "Only match files with at most this many hard links")
+	long := set.Bool("l", false, "Show file attributes")
+	numeric := set.Bool("n", false, "With -l, show numeric ids")
+	print0 := set.Bool("0", false, "Separate paths with a null character instead of a newline")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(0)
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	q := squashfs.Query{
+		Name:     *name,
+		Path:     *pathPattern,
+		Empty:    *empty,
+		MinLinks: uint32(*minLinks),
+		MaxLinks: uint32(*maxLinks),
+	}
+	var err error
+	if q.Types, err = parseTypes(*types); err != nil {
+		fail(err)
+	}
+	if *minSize != "" {
+		if q.MinSize, err = parseSize(*minSize); err != nil {
+			fail(err)
+		}
+	}
+	if *maxSize != "" {
+		if q.MaxSize, err = parseSize(*maxSize); err != nil {
+			fail(err)
+		}
+	}
+	if *after != "" {
+		if q.ModifiedAfter, err = parseTime(*after); err != nil {
+			fail(err)
+		}
+	}
+	if *before != "" {
+		if q.ModifiedBefore, err = parseTime(*before); err != nil {
+			fail(err)
+		}
+	}
+	if *uids != "" {
+		if q.Uids, err = parseIds(*uids); err != nil {
+			fail(err)
+		}
+	}
+	if *gids != "" {
+		if q.Gids, err = parseIds(*gids); err != nil {
+			fail(err)
+		}
+	}
+	if *perm != "" {
+		p, anyBit := strings.CutPrefix(*perm, "/")
+		val, err := strconv.ParseUint(p, 8, 32)
+		if err != nil {
+			fail(fmt.Errorf("invalid permissions: %s", *perm))
+		}
+		if anyBit {
+			q.PermAny = fs.FileMode(val)
+		} else {
+			q.PermAll = fs.FileMode(val)
+		}
+	}
+	r := openReader(set.Arg(0), *offset)
+	root := r.FS
+	prefix := ""
+	if set.NArg() > 1 && set.Arg(1) != "." {
+		sub, err := r.Sub(set.Arg(1))
+		if err != nil {
+			fail(err)
+		}
+		root = sub.(squashfs.FS)
+		prefix = set.Arg(1) + "/"
+	}
+	end := "\n"
+	if *print0 {
+		end = "\x00"
+	}
+	err = root.Find(q, func(p string, d *squashfs.DirEntry) error {
+		p = prefix + p
+		if !*long {
+			fmt.Print(p, end)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fi := info.(squashfs.FileInfo)
+		if fi.IsSymlink() {
+			p += " -> " + fi.SymlinkPath()
+		}
+		fmt.Print(longLine(fi, ownerString(fi, *numeric), fi.Size(), p), end)
+		return nil
+	})
+	if err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+func grep(args []string) {
+	set := flag.NewFlagSet("grep", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs grep [flags] pattern archive")
+		fmt.Fprintln(set.Output(), "Searches the contents of the archive's regular files for a regular expression.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	literal := set.Bool("F", false, "Treat the pattern as a literal string instead of a regular expression")
+	ignoreCase := set.Bool("i", false, "Ignore case")
+	glob := set.String("glob", "", "Only search files whose path matches the pattern. ** matches any number of directories")
+	skipBinary := set.Bool("I", false, "Skip binary files")
+	context := set.Int("C", 0, "Show this many lines of context around matches")
+	byteOffset := set.Bool("b", false, "Show the byte offset of each match")
+	filesOnly := set.Bool("l", false, "Only show the paths of files with matches")
+	routines := set.Int("j", 0, "The number of files to search at once. Defaults to the number of CPUs")
+	set.Parse(args)
+	if set.NArg() < 2 {
+		set.Usage()
+		os.Exit(0)
+	}
+	op := squashfs.GrepOptions{
+		Glob:       *glob,
+		SkipBinary: *skipBinary,
+		Context:    *context,
+		Routines:   *routines,
+	}
+	pattern := set.Arg(0)
+	if *literal && !*ignoreCase {
+		op.Literal = []byte(pattern)
+	} else {
+		if *literal {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		if *ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		var err error
+		op.Pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	r := openReader(set.Arg(1), *offset)
+	var last string
+	found := false
+	err := r.Grep(op, func(m squashfs.GrepMatch) error {
+		newFile := m.Path != last
+		last = m.Path
+		switch {
+		case *filesOnly:
+			if newFile {
+				fmt.Println(m.Path)
+			}
+		case m.Binary:
+			if newFile {
+				fmt.Println("Binary file", m.Path, "matches")
+			}
+		default:
+			if *context > 0 && found {
+				fmt.Println("--")
+			}
+			for i, l := range m.Before {
+				fmt.Printf("%s-%d-%s\n", m.Path, m.Line-len(m.Before)+i, l)
+			}
+			prefix := m.Path + ":" + strconv.Itoa(m.Line) + ":"
+			if *byteOffset {
+				prefix += strconv.FormatInt(m.Offset, 10) + ":"
+			}
+			fmt.Printf("%s%s\n", prefix, m.Text)
+			for i, l := range m.After {
+				fmt.Printf("%s-%d-%s\n", m.Path, m.Line+i+1, l)
+			}
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !found {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+var hashes = map[string]crypto.Hash{
+	"md5":    crypto.MD5,
+	"sha1":   crypto.SHA1,
+	"sha224": crypto.SHA224,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+func hash(args []string) {
+	set := flag.NewFlagSet("hash", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs hash [flags] archive [directory]")
+		fmt.Fprintln(set.Output(), "Hashes every regular file in the archive. By default the output can be checked with sha256sum -c.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	hashName := set.String("hash", "sha256", "The hash function. One of md5, sha1, sha224, sha256, sha384, or sha512")
+	jsonOut := set.Bool("json", false, "Output a JSON manifest of every file, including directories and symlinks")
+	glob := set.String("glob", "", "Only include files whose path matches the pattern. ** matches any number of directories")
+	routines := set.Int("j", 0, "The number of files to hash at once. Defaults to the number of CPUs")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(0)
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	h, ok := hashes[*hashName]
+	if !ok {
+		fail(fmt.Errorf("unknown hash: %s", *hashName))
+	}
+	r := openReader(set.Arg(0), *offset)
+	root := r.FS
+	if set.NArg() > 1 && set.Arg(1) != "." {
+		sub, err := r.Sub(set.Arg(1))
+		if err != nil {
+			fail(err)
+		}
+		root = sub.(squashfs.FS)
+	}
+	m, err := root.Manifest(squashfs.ManifestOptions{
+		Hash:     h,
+		Query:    squashfs.Query{Path: *glob},
+		Routines: *routines,
+	})
+	if err != nil {
+		fail(err)
+	}
+	if *jsonOut {
+		err = m.WriteJSON(os.Stdout)
+	} else {
+		err = m.WriteSums(os.Stdout)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -11,7 +12,9 @@ import (
 	"time"
 
 	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/httpreader"
 	squashfslow "github.com/CalebQ42/squashfs/low"
+	"github.com/CalebQ42/squashfs/split"
 )
 
 func userName(uid int, numeric bool) string {
@@ -36,15 +39,26 @@ func groupName(gid int, numeric bool) string {
 	return gs
 }
 
+func ownerString(fi squashfs.FileInfo, numeric bool) string {
+	return userName(fi.Uid(), numeric) + "/" + groupName(fi.Gid(), numeric)
+}
+
+// Formats a file like ls -l. name may include a symlink's target.
+func longLine(fi squashfs.FileInfo, owner string, size int64, name string) string {
+	return fmt.Sprintf("%s %s %*d %s %s",
+		strings.ToLower(fi.Mode().String()),
+		owner, 26-len(owner), size,
+		fi.ModTime().Format("2006-01-02 15:04"),
+		name)
+}
+
 var hardLinks = make(map[uint32]string)
 
 func printFile(rdr *squashfs.Reader, path string, f *squashfs.File) {
 	path = filepath.Join(path, f.Low.Name)
 	fi, _ := f.Stat()
 	sfi := fi.(squashfs.FileInfo)
-	owner := fmt.Sprintf("%s/%s",
-		userName(sfi.Uid(), *numeric),
-		groupName(sfi.Gid(), *numeric))
+	owner := ownerString(sfi, *numeric)
 	var link string
 	var isHardLink bool
 	if *showHardLinks {
@@ -64,11 +78,7 @@ func printFile(rdr *squashfs.Reader, path string, f *squashfs.File) {
 	} else if isHardLink {
 		link = " link to " + link
 	}
-	fmt.Printf("%s %s %*d %s %s%s\n",
-		strings.ToLower(fi.Mode().String()),
-		owner, 26-len(owner), size,
-		fi.ModTime().Format("2006-01-02 15:04"),
-		path, link)
+	fmt.Println(longLine(sfi, owner, size, path+link))
 	if f.IsDir() {
 		fs, _ := f.FS()
 		printDir(rdr, path, fs)
@@ -100,7 +110,81 @@ var (
 	showHardLinks *bool
 )
 
+// Subcommands are given as the first argument, before any flags.
+var subcommands = map[string]func(args []string){
+	"diff":   diff,
+	"du":     du,
+	"find":   find,
+	"grep":   grep,
+	"hash":   hash,
+	"mtree":  mtree,
+	"serve":  serve,
+	"verify": verify,
+}
+
+// Opens the archive at name. name can be a local file, a http(s) url, or a glob matching the parts of a split archive
+// such as "image.sqfs.*". If name doesn't exist but name.000 does, or name is the first part (image.sqfs.000),
+// all the parts are used.
+func openReader(name string, offset int64) squashfs.Reader {
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		if _, err := os.Stat(name + ".000"); err == nil {
+			if _, err = os.Stat(name); os.IsNotExist(err) {
+				name += ".*"
+			}
+		} else if base, found := strings.CutSuffix(name, ".000"); found {
+			if _, err = os.Stat(base + ".001"); err == nil {
+				name = base + ".*"
+			}
+		}
+		if strings.ContainsAny(name, "*?[") {
+			return openParts(name, offset)
+		}
+	}
+	var f io.ReaderAt
+	var err error
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		f, err = httpreader.New(name, nil)
+	} else {
+		f, err = os.Open(name)
+	}
+	if err != nil {
+		panic(err)
+	}
+	r, err := squashfs.NewReaderAtOffset(f, offset)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func openParts(pattern string, offset int64) squashfs.Reader {
+	paths, err := split.Glob(pattern)
+	if err != nil {
+		panic(err)
+	}
+	var r squashfs.Reader
+	if offset == 0 {
+		r, err = squashfs.OpenParts(paths...)
+	} else {
+		var sr *split.Reader
+		sr, err = split.Open(paths...)
+		if err == nil {
+			r, err = squashfs.NewReaderAtOffset(sr, offset)
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 	verbose = flag.Bool("v", false, "Verbose")
 	list = flag.Bool("l", false, "List")
 	long = flag.Bool("ll", false, "List with attributes")
@@ -117,15 +201,13 @@ func main() {
 		fmt.Println("Please provide a file name and extraction path")
 		os.Exit(0)
 	}
-	f, err := os.Open(flag.Arg(0))
-	if err != nil {
-		panic(err)
-	}
-	r, err := squashfs.NewReaderAtOffset(f, *offset)
-	if err != nil {
-		panic(err)
+	if flag.Arg(0) == "-" {
+		extractStream()
+		return
 	}
+	r := openReader(flag.Arg(0), *offset)
 	extractFil := r.File()
+	var err error
 	if *file != "" {
 		extractFil, err = r.OpenFile(*file)
 		if err != nil {
@@ -146,3 +228,20 @@ func main() {
 	}
 	fmt.Println("Took:", time.Since(n))
 }
+
+// Extracts an archive from stdin.
+func extractStream() {
+	if *list || *long || *numeric || *file != "" || *offset != 0 {
+		fmt.Println("Listing, -e, and -o aren't supported when reading from stdin")
+		os.Exit(1)
+	}
+	op := squashfs.DefaultStreamOptions()
+	op.Extraction.Verbose = *verbose
+	op.Extraction.IgnorePerm = *ignore
+	n := time.Now()
+	err := squashfs.ExtractStream(os.Stdin, flag.Arg(1), op)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("Took:", time.Since(n))
+}
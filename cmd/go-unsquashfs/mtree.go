@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+func mtree(args []string) {
+	set := flag.NewFlagSet("mtree", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs mtree [flags] archive [directory]")
+		fmt.Fprintln(set.Output(), "Prints an mtree specification of the archive, or with -f, checks the archive against a specification.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	spec := set.String("f", "", "Check the archive against this mtree specification instead of printing one")
+	hashName := set.String("hash", "sha256", "The digest to include. One of md5, sha1, sha256, sha384, or sha512")
+	routines := set.Int("j", 0, "The number of files to hash at once. Defaults to the number of CPUs")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(0)
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	h, ok := hashes[*hashName]
+	if !ok {
+		fail(fmt.Errorf("unknown hash: %s", *hashName))
+	}
+	r := openReader(set.Arg(0), *offset)
+	root := r.FS
+	if set.NArg() > 1 && set.Arg(1) != "." {
+		sub, err := r.Sub(set.Arg(1))
+		if err != nil {
+			fail(err)
+		}
+		root = sub.(squashfs.FS)
+	}
+	if *spec == "" {
+		err := root.WriteMtree(os.Stdout, squashfs.ManifestOptions{Hash: h, Routines: *routines})
+		if err != nil {
+			fail(err)
+		}
+		return
+	}
+	f, err := os.Open(*spec)
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+	diffs, err := root.VerifyMtree(f)
+	if err != nil {
+		fail(err)
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		f.Close()
+		os.Exit(1)
+	}
+}
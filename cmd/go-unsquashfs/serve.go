@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/fileserver"
+)
+
+func serve(args []string) {
+	set := flag.NewFlagSet("serve", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs serve [flags] archive [address]")
+		fmt.Fprintln(set.Output(), "Serves the archive's files over HTTP. address defaults to :8080.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	file := set.String("e", "", "Serve this folder of the archive instead of the whole archive")
+	symlinks := set.String("symlinks", "follow", "How symlinks are served. One of follow, redirect, or deny")
+	noList := set.Bool("no-list", false, "Don't list directories without an index.html")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(0)
+	}
+	addr := ":8080"
+	if set.NArg() > 1 {
+		addr = set.Arg(1)
+	}
+	policy, err := fileserver.ParseSymlinkPolicy(*symlinks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r := openReader(set.Arg(0), *offset)
+	root := r.FS
+	if *file != "" && *file != "." {
+		sub, err := r.Sub(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		root = sub.(squashfs.FS)
+	}
+	h := fileserver.NewWithOptions(root, fileserver.Options{
+		Symlinks:  policy,
+		NoListing: *noList,
+	})
+	fmt.Fprintln(os.Stderr, "Serving", set.Arg(0), "on", addr)
+	err = http.ListenAndServe(addr, h)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
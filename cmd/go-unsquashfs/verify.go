@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+func verify(args []string) {
+	set := flag.NewFlagSet("verify", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintln(set.Output(), "Usage: go-unsquashfs verify [flags] archive directory")
+		fmt.Fprintln(set.Output(), "Compares the archive to a directory it was extracted to. Lists the files missing from (-), extra in (+), and different in (~) the directory.")
+		set.PrintDefaults()
+	}
+	offset := set.Int64("o", 0, "Offset")
+	file := set.String("e", "", "Compare this folder of the archive instead of the whole archive")
+	ignoreOwner := set.Bool("ignore-owner", false, "Don't compare uids and gids")
+	ignoreModTime := set.Bool("ignore-mtime", false, "Don't compare modification times")
+	ignorePerm := set.Bool("ignore-perm", false, "Don't compare permissions")
+	fast := set.Bool("fast", false, "Only compare the sizes and modification times of regular files, not their contents")
+	quiet := set.Bool("q", false, "Don't list the differences, only set the exit status")
+	routines := set.Int("j", 0, "The number of files to compare at once. Defaults to the number of CPUs")
+	set.Parse(args)
+	if set.NArg() < 2 {
+		set.Usage()
+		os.Exit(0)
+	}
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	r := openReader(set.Arg(0), *offset)
+	root := r.FS
+	if *file != "" && *file != "." {
+		sub, err := r.Sub(*file)
+		if err != nil {
+			fail(err)
+		}
+		root = sub.(squashfs.FS)
+	}
+	diffs, err := root.VerifyDir(set.Arg(1), squashfs.VerifyOptions{
+		IgnoreOwner:   *ignoreOwner,
+		IgnoreModTime: *ignoreModTime,
+		IgnorePerm:    *ignorePerm,
+		Fast:          *fast,
+		Routines:      *routines,
+	})
+	if err != nil {
+		fail(err)
+	}
+	if !*quiet {
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
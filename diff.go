@@ -0,0 +1,386 @@
+package squashfs
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io/fs"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	squashfslow "github.com/CalebQ42/squashfs/low"
+	"github.com/CalebQ42/squashfs/low/directory"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// The kind of a Difference.
+type DiffKind uint8
+
+const (
+	DiffAdded   DiffKind = iota // The file is only in the new FS.
+	DiffRemoved                 // The file is only in the old FS.
+	DiffChanged                 // The file is in both, but is different.
+)
+
+// What's different about a changed file. A Difference can have multiple changes.
+type ChangeKind uint16
+
+const (
+	ChangeType    ChangeKind = 1 << iota // The file's type, such as a file becoming a directory. Nothing else is compared.
+	ChangeContent                        // The contents of a regular file.
+	ChangeMode                           // The permission bits, including the setuid, setgid, and sticky bits.
+	ChangeOwner                          // The uid or gid.
+	ChangeModTime
+	ChangeTarget // A symlink's target.
+	ChangeDevice // A device's device number.
+	ChangeXattr
+)
+
+var changeNames = []string{"type", "content", "mode", "owner", "mtime", "target", "device", "xattr"}
+
+// Returns the changes' names, separated by commas, such as "content,mode".
+func (c ChangeKind) String() string {
+	var out []string
+	for i, name := range changeNames {
+		if c&(1<<i) != 0 {
+			out = append(out, name)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// Parses a comma separated list of changes, the same as returned by ChangeKind.String.
+func ParseChangeKind(s string) (out ChangeKind, err error) {
+	for _, name := range strings.Split(s, ",") {
+		i := slices.Index(changeNames, strings.TrimSpace(name))
+		if i == -1 {
+			return 0, errors.New("unknown change: " + name)
+		}
+		out |= 1 << i
+	}
+	return
+}
+
+// A difference between two FS found by FS.Diff.
+type Difference struct {
+	Path    string
+	Kind    DiffKind
+	Changes ChangeKind // Only set for DiffChanged.
+	// The file in the old and new FS. Old isn't set for added files and New isn't set for removed files.
+	Old, New FileInfo
+}
+
+// Returns the difference as "+ path" for added files, "- path" for removed files, and "~ path (changes)" for changed files.
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return "+ " + d.Path
+	case DiffRemoved:
+		return "- " + d.Path
+	}
+	return "~ " + d.Path + " (" + d.Changes.String() + ")"
+}
+
+// Options for FS.Diff.
+type DiffOptions struct {
+	// Changes that aren't compared. Files that only have these changes aren't reported.
+	Ignore ChangeKind
+	// The number of files whose contents are hashed at once. Defaults to runtime.NumCPU().
+	Routines int
+}
+
+// Compares f, the old FS, to other, the new FS. Both trees are walked together and the differences are returned in the same order as
+// fs.WalkDir. The FS's directories themselves are compared as ".". If a directory is added or removed, each file in it is too.
+//
+// Contents are compared as cheaply as possible. Files of different sizes are always different. If both FS are from the same archive,
+// or archives with the same compression and block size, the files' block size lists and fragments are compared first
+// (see squashfslow.CompareData). Only if that isn't enough are the files hashed, concurrently.
+func (f FS) Diff(other FS, op DiffOptions) ([]Difference, error) {
+	if op.Routines <= 0 {
+		op.Routines = runtime.NumCPU()
+	}
+	d := &differ{a: f.r, b: other.r, op: op}
+	recurse, err := d.compare(".", f.LowDir.FileBase, other.LowDir.FileBase)
+	if err != nil {
+		return nil, err
+	}
+	if recurse {
+		err = d.compareEntries(".", f.LowDir.Entries, other.LowDir.Entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = d.compareContents()
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(d.out, func(diff Difference) bool {
+		return diff.Kind == DiffChanged && diff.Changes == 0
+	}), nil
+}
+
+type differ struct {
+	a, b *Reader
+	op   DiffOptions
+	out  []Difference
+	// Indexes in out of files whose contents need to be hashed, and the files.
+	toHash []int
+	hashA  []squashfslow.FileBase
+	hashB  []squashfslow.FileBase
+}
+
+// Returns the type of an inode, treating basic and extended inodes the same.
+func baseType(t uint16) uint16 {
+	if t > inode.Sock {
+		return t - inode.Sock
+	}
+	return t
+}
+
+// Compares the files and adds them to out. Returns whether both are directories whose contents should be compared.
+func (d *differ) compare(p string, a, b squashfslow.FileBase) (bool, error) {
+	aInfo, err := d.a.fileInfoFromBase(a)
+	if err != nil {
+		return false, &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	bInfo, err := d.b.fileInfoFromBase(b)
+	if err != nil {
+		return false, &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	diff := Difference{Path: p, Kind: DiffChanged, Old: aInfo, New: bInfo}
+	if baseType(a.Inode.Type) != baseType(b.Inode.Type) {
+		diff.Changes = ChangeType &^ d.op.Ignore
+		d.out = append(d.out, diff)
+		if a.IsDir() {
+			err = d.all(d.a, p, a, DiffRemoved)
+			if err != nil {
+				return false, err
+			}
+		}
+		if b.IsDir() {
+			return false, d.all(d.b, p, b, DiffAdded)
+		}
+		return false, nil
+	}
+	if a.Inode.Perm != b.Inode.Perm {
+		diff.Changes |= ChangeMode
+	}
+	if aInfo.uid != bInfo.uid || aInfo.gid != bInfo.gid {
+		diff.Changes |= ChangeOwner
+	}
+	if a.Inode.ModTime != b.Inode.ModTime {
+		diff.Changes |= ChangeModTime
+	}
+	if aInfo.target != bInfo.target {
+		diff.Changes |= ChangeTarget
+	}
+	switch baseType(a.Inode.Type) {
+	case inode.Block, inode.Char:
+		if deviceNum(a.Inode) != deviceNum(b.Inode) {
+			diff.Changes |= ChangeDevice
+		}
+	}
+	if d.op.Ignore&ChangeXattr == 0 {
+		same, err := d.sameXattrs(a, b)
+		if err != nil {
+			return false, &fs.PathError{Op: "diff", Path: p, Err: err}
+		}
+		if !same {
+			diff.Changes |= ChangeXattr
+		}
+	}
+	diff.Changes &^= d.op.Ignore
+	d.out = append(d.out, diff)
+	if a.IsRegular() && d.op.Ignore&ChangeContent == 0 {
+		cmp, err := squashfslow.CompareData(&d.a.Low, a, &d.b.Low, b)
+		if err != nil {
+			return false, &fs.PathError{Op: "diff", Path: p, Err: err}
+		}
+		switch cmp {
+		case squashfslow.DataDifferent:
+			d.out[len(d.out)-1].Changes |= ChangeContent
+		case squashfslow.DataUnknown:
+			d.toHash = append(d.toHash, len(d.out)-1)
+			d.hashA = append(d.hashA, a)
+			d.hashB = append(d.hashB, b)
+		}
+	}
+	return a.IsDir(), nil
+}
+
+func deviceNum(i inode.Inode) uint32 {
+	switch dev := i.Data.(type) {
+	case inode.Device:
+		return dev.Dev
+	case inode.EDevice:
+		return dev.Dev
+	}
+	return 0
+}
+
+func (d *differ) sameXattrs(a, b squashfslow.FileBase) (bool, error) {
+	aX, err := a.Xattrs(&d.a.Low)
+	if err != nil {
+		return false, err
+	}
+	bX, err := b.Xattrs(&d.b.Low)
+	if err != nil {
+		return false, err
+	}
+	if len(aX) != len(bX) {
+		return false, nil
+	}
+	byName := func(x, y squashfslow.Xattr) int { return strings.Compare(x.Name, y.Name) }
+	slices.SortFunc(aX, byName)
+	slices.SortFunc(bX, byName)
+	return slices.EqualFunc(aX, bX, func(x, y squashfslow.Xattr) bool {
+		return x.Name == y.Name && bytes.Equal(x.Value, y.Value)
+	}), nil
+}
+
+func (d *differ) compareDirs(p string, a, b squashfslow.FileBase) error {
+	aDir, err := a.ToDir(d.a.Low)
+	if err != nil {
+		return &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	bDir, err := b.ToDir(d.b.Low)
+	if err != nil {
+		return &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	return d.compareEntries(p, aDir.Entries, bDir.Entries)
+}
+
+// Walks both directories' entries in name order.
+func (d *differ) compareEntries(p string, aEnts, bEnts []directory.Entry) error {
+	aEnts, bEnts = sortedEntries(aEnts), sortedEntries(bEnts)
+	var err error
+	for len(aEnts) > 0 || len(bEnts) > 0 {
+		var cmp int
+		switch {
+		case len(aEnts) == 0:
+			cmp = 1
+		case len(bEnts) == 0:
+			cmp = -1
+		default:
+			cmp = strings.Compare(aEnts[0].Name, bEnts[0].Name)
+		}
+		var name string
+		var aBase, bBase squashfslow.FileBase
+		if cmp <= 0 {
+			name = aEnts[0].Name
+			aBase, err = d.a.Low.BaseFromEntry(aEnts[0])
+			if err != nil {
+				return &fs.PathError{Op: "diff", Path: path.Join(p, name), Err: err}
+			}
+			aEnts = aEnts[1:]
+		}
+		if cmp >= 0 {
+			name = bEnts[0].Name
+			bBase, err = d.b.Low.BaseFromEntry(bEnts[0])
+			if err != nil {
+				return &fs.PathError{Op: "diff", Path: path.Join(p, name), Err: err}
+			}
+			bEnts = bEnts[1:]
+		}
+		sub := path.Join(p, name)
+		switch {
+		case cmp < 0:
+			err = d.add(d.a, sub, aBase, DiffRemoved)
+		case cmp > 0:
+			err = d.add(d.b, sub, bBase, DiffAdded)
+		default:
+			var recurse bool
+			recurse, err = d.compare(sub, aBase, bBase)
+			if err == nil && recurse {
+				err = d.compareDirs(sub, aBase, bBase)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedEntries(ents []directory.Entry) []directory.Entry {
+	return slices.SortedFunc(slices.Values(ents), func(x, y directory.Entry) int {
+		return strings.Compare(x.Name, y.Name)
+	})
+}
+
+// Adds the file, and it's contents if it's a directory, as added or removed.
+func (d *differ) add(r *Reader, p string, b squashfslow.FileBase, kind DiffKind) error {
+	info, err := r.fileInfoFromBase(b)
+	if err != nil {
+		return &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	diff := Difference{Path: p, Kind: kind}
+	if kind == DiffAdded {
+		diff.New = info
+	} else {
+		diff.Old = info
+	}
+	d.out = append(d.out, diff)
+	if b.IsDir() {
+		return d.all(r, p, b, kind)
+	}
+	return nil
+}
+
+// Adds the contents of the directory as added or removed.
+func (d *differ) all(r *Reader, p string, b squashfslow.FileBase, kind DiffKind) error {
+	dir, err := b.ToDir(r.Low)
+	if err != nil {
+		return &fs.PathError{Op: "diff", Path: p, Err: err}
+	}
+	for _, e := range sortedEntries(dir.Entries) {
+		sub, err := r.Low.BaseFromEntry(e)
+		if err != nil {
+			return &fs.PathError{Op: "diff", Path: path.Join(p, e.Name), Err: err}
+		}
+		err = d.add(r, path.Join(p, e.Name), sub, kind)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hashes the files whose contents couldn't be compared cheaply.
+func (d *differ) compareContents() error {
+	var (
+		wg   sync.WaitGroup
+		mut  sync.Mutex
+		errs []error
+	)
+	work := make(chan int)
+	for range d.op.Routines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				aSum, err := hashBase(&d.a.Low, crypto.SHA256, d.hashA[i])
+				var bSum []byte
+				if err == nil {
+					bSum, err = hashBase(&d.b.Low, crypto.SHA256, d.hashB[i])
+				}
+				mut.Lock()
+				if err != nil {
+					errs = append(errs, &fs.PathError{Op: "diff", Path: d.out[d.toHash[i]].Path, Err: err})
+				} else if !bytes.Equal(aSum, bSum) {
+					d.out[d.toHash[i]].Changes |= ChangeContent
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	for i := range d.toHash {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return errors.Join(errs...)
+}
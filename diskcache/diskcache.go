@@ -0,0 +1,338 @@
+// Package diskcache provides an io.ReaderAt that caches another io.ReaderAt on disk.
+// It's meant to sit between a squashfs Reader and a slow source, such as network storage or a httpreader.Reader,
+// so data fetched by one process is available to later processes.
+package diskcache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The number of bytes at the start of the source that are hashed to identify it. The size of a squashfs superblock.
+const identityBytes = 96
+
+type Options struct {
+	// The size of the chunks the source is split into. Each chunk is a separate file. Defaults to 256KiB.
+	ChunkSize int64
+	// The maximum size of the cache directory, including other sources cached in the same directory.
+	// When exceeded, the least recently used chunks are removed. Defaults to 1GiB.
+	MaxSize int64
+	// The size of the source, used to identify it. If zero, the size is taken from the source if it has a Size() int64
+	// or Stat() (fs.FileInfo, error) method.
+	Size int64
+	// The modification time of the source, used to identify it. If zero, the time is taken from the source if it has a
+	// LastModified() time.Time or Stat() (fs.FileInfo, error) method.
+	ModTime time.Time
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		ChunkSize: 256 * 1024,
+		MaxSize:   1024 * 1024 * 1024,
+	}
+}
+
+// Cache is an io.ReaderAt that stores data read from it's source in a cache directory.
+//
+// Cached data is stored per source, identified by the source's size, modification time, and a hash of it's first 96 bytes
+// (a squashfs superblock), so a changed source never uses stale data. Chunks are written to a temporary file then renamed,
+// so multiple processes can safely share the same cache directory.
+type Cache struct {
+	op       Options
+	src      io.ReaderAt
+	dir      string
+	chunkDir string
+	mut      sync.Mutex
+	inflight map[int64]*chunkFetch
+	touched  map[int64]bool
+	written  int64
+}
+
+type chunkFetch struct {
+	done chan struct{}
+	dat  []byte
+	err  error
+}
+
+// Creates a new Cache for src, storing data in dir. dir is created if it doesn't exist. If op is nil, DefaultOptions is used.
+func New(src io.ReaderAt, dir string, op *Options) (*Cache, error) {
+	def := DefaultOptions()
+	if op == nil {
+		op = def
+	}
+	out := &Cache{
+		op:       *op,
+		src:      src,
+		dir:      dir,
+		inflight: make(map[int64]*chunkFetch),
+		touched:  make(map[int64]bool),
+	}
+	if out.op.ChunkSize <= 0 {
+		out.op.ChunkSize = def.ChunkSize
+	}
+	if out.op.MaxSize <= 0 {
+		out.op.MaxSize = def.MaxSize
+	}
+	if sizer, ok := src.(interface{ Size() int64 }); ok && out.op.Size == 0 {
+		out.op.Size = sizer.Size()
+	}
+	if lm, ok := src.(interface{ LastModified() time.Time }); ok && out.op.ModTime.IsZero() {
+		out.op.ModTime = lm.LastModified()
+	}
+	if st, ok := src.(interface{ Stat() (fs.FileInfo, error) }); ok && (out.op.Size == 0 || out.op.ModTime.IsZero()) {
+		stat, err := st.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if out.op.Size == 0 {
+			out.op.Size = stat.Size()
+		}
+		if out.op.ModTime.IsZero() {
+			out.op.ModTime = stat.ModTime()
+		}
+	}
+	id, err := out.identity()
+	if err != nil {
+		return nil, err
+	}
+	out.chunkDir = filepath.Join(dir, id)
+	err = os.MkdirAll(out.chunkDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Returns a hex encoded hash identifying the source.
+func (c *Cache) identity() (string, error) {
+	head := make([]byte, identityBytes)
+	n, err := c.src.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", errors.Join(errors.New("failed to read source's identity"), err)
+	}
+	h := sha256.New()
+	h.Write(head[:n])
+	h.Write(binary.LittleEndian.AppendUint64(nil, uint64(c.op.Size)))
+	if !c.op.ModTime.IsZero() {
+		h.Write(binary.LittleEndian.AppendUint64(nil, uint64(c.op.ModTime.UnixNano())))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// The directory where the source's chunks are stored.
+func (c *Cache) Dir() string {
+	return c.chunkDir
+}
+
+func (c *Cache) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		cur := off + int64(n)
+		idx := cur / c.op.ChunkSize
+		dat, err := c.chunk(idx)
+		if err != nil {
+			return n, err
+		}
+		chunkOff := cur - idx*c.op.ChunkSize
+		if chunkOff >= int64(len(dat)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], dat[chunkOff:])
+		if int64(len(dat)) < c.op.ChunkSize && n < len(p) {
+			// A short chunk is the end of the source.
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+func (c *Cache) chunkPath(idx int64) string {
+	return filepath.Join(c.chunkDir, strconv.FormatInt(idx, 16))
+}
+
+// Returns the chunk at idx, from disk if present, otherwise from the source.
+func (c *Cache) chunk(idx int64) ([]byte, error) {
+	dat, err := os.ReadFile(c.chunkPath(idx))
+	if err == nil {
+		c.touch(idx)
+		return dat, nil
+	}
+	c.mut.Lock()
+	if f, has := c.inflight[idx]; has {
+		c.mut.Unlock()
+		<-f.done
+		return f.dat, f.err
+	}
+	f := &chunkFetch{done: make(chan struct{})}
+	c.inflight[idx] = f
+	c.mut.Unlock()
+	f.dat, f.err = c.fetch(idx)
+	c.mut.Lock()
+	delete(c.inflight, idx)
+	c.mut.Unlock()
+	close(f.done)
+	return f.dat, f.err
+}
+
+func (c *Cache) fetch(idx int64) ([]byte, error) {
+	dat := make([]byte, c.op.ChunkSize)
+	n, err := c.src.ReadAt(dat, idx*c.op.ChunkSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	dat = dat[:n]
+	if !c.complete(idx, n, err == io.EOF) {
+		// A read past the end, or a short read, isn't cached so it can't be served in place of real data later.
+		return dat, nil
+	}
+	tmp, err := os.CreateTemp(c.chunkDir, ".tmp-")
+	if err != nil {
+		// Failing to cache shouldn't fail the read.
+		return dat, nil
+	}
+	_, err = tmp.Write(dat)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.chunkPath(idx))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return dat, nil
+	}
+	c.mut.Lock()
+	c.touched[idx] = true
+	c.written += int64(n)
+	evict := c.written > c.op.MaxSize/16
+	if evict {
+		c.written = 0
+	}
+	c.mut.Unlock()
+	if evict {
+		go c.Evict()
+	}
+	return dat, nil
+}
+
+// Returns whether n bytes read for the chunk at idx is the whole chunk. Only a full chunk, or the source's final
+// partial chunk, is complete.
+func (c *Cache) complete(idx int64, n int, eof bool) bool {
+	if int64(n) == c.op.ChunkSize {
+		return true
+	}
+	if n == 0 || !eof {
+		return false
+	}
+	return c.op.Size == 0 || idx*c.op.ChunkSize+int64(n) == c.op.Size
+}
+
+// Updates the chunk's modification time, used to determine which chunks were least recently used.
+// Only done once per Cache so repeated reads don't cause repeated writes.
+func (c *Cache) touch(idx int64) {
+	c.mut.Lock()
+	if c.touched[idx] {
+		c.mut.Unlock()
+		return
+	}
+	c.touched[idx] = true
+	c.mut.Unlock()
+	now := time.Now()
+	os.Chtimes(c.chunkPath(idx), now, now)
+}
+
+// Removes the least recently used chunks, from every source in the cache directory, until the directory is under Options.MaxSize.
+// Only chunks, in the directories named after each source's identity, are counted and removed. Other files in the directory,
+// and chunks that are still being written, are left alone. Called automatically as data is added to the cache.
+func (c *Cache) Evict() error {
+	type chunkInfo struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var chunks []chunkInfo
+	var total int64
+	sources, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if !src.IsDir() || !isIdentity(src.Name()) {
+			continue
+		}
+		ents, err := os.ReadDir(filepath.Join(c.dir, src.Name()))
+		if err != nil {
+			// Another process may have removed it.
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		for _, e := range ents {
+			if !e.Type().IsRegular() || !isChunkName(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			chunks = append(chunks, chunkInfo{path: filepath.Join(c.dir, src.Name(), e.Name()), size: info.Size(), mod: info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if total <= c.op.MaxSize {
+		return nil
+	}
+	slices.SortFunc(chunks, func(a, b chunkInfo) int {
+		return a.mod.Compare(b.mod)
+	})
+	for _, ch := range chunks {
+		if total <= c.op.MaxSize {
+			break
+		}
+		err = os.Remove(ch.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= ch.size
+	}
+	return nil
+}
+
+// Returns whether name is a source's directory, as named by identity.
+func isIdentity(name string) bool {
+	if len(name) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// Returns whether name is a chunk, as named by chunkPath. Temporary files start with a '.', so they never match.
+func isChunkName(name string) bool {
+	_, err := strconv.ParseUint(name, 16, 63)
+	return err == nil
+}
+
+// Removes all cached data for the source.
+func (c *Cache) Clear() error {
+	err := os.RemoveAll(c.chunkDir)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	c.touched = make(map[int64]bool)
+	c.mut.Unlock()
+	return os.MkdirAll(c.chunkDir, 0755)
+}
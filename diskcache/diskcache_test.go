@@ -0,0 +1,198 @@
+package diskcache
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingReader struct {
+	r     io.ReaderAt
+	reads atomic.Int32
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.reads.Add(1)
+	return c.r.ReadAt(p, off)
+}
+
+func (c *countingReader) Size() int64 {
+	return c.r.(*bytes.Reader).Size()
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	dat := make([]byte, 100*1024+17)
+	rand.New(rand.NewSource(42)).Read(dat)
+	op := DefaultOptions()
+	op.ChunkSize = 4096
+	op.ModTime = time.Unix(1000, 0)
+	src := &countingReader{r: bytes.NewReader(dat)}
+	c, err := New(src, dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(c *Cache) {
+		rng := rand.New(rand.NewSource(1))
+		for range 200 {
+			off := rng.Int63n(int64(len(dat)))
+			buf := make([]byte, rng.Intn(10000))
+			n, err := c.ReadAt(buf, off)
+			want := min(len(buf), len(dat)-int(off))
+			if n != want {
+				t.Fatal("read", n, "bytes instead of", want)
+			}
+			if n < len(buf) && err != io.EOF {
+				t.Fatal("short read without io.EOF:", err)
+			} else if n == len(buf) && err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf[:n], dat[off:off+int64(n)]) {
+				t.Fatal("data mismatch at offset", off)
+			}
+		}
+	}
+	check(c)
+	// A new Cache for the same source should only read the identity from the source.
+	src2 := &countingReader{r: bytes.NewReader(dat)}
+	c2, err := New(src2, dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.Dir() != c.Dir() {
+		t.Fatal("same source has different identities")
+	}
+	check(c2)
+	if reads := src2.reads.Load(); reads != 1 {
+		t.Fatal("cached source was read", reads, "times")
+	}
+	// A changed source must not use the old data.
+	changed := bytes.Clone(dat)
+	changed[0]++
+	c3, err := New(&countingReader{r: bytes.NewReader(changed)}, dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3.Dir() == c.Dir() {
+		t.Fatal("changed source has the same identity")
+	}
+	op.ModTime = time.Unix(2000, 0)
+	c4, err := New(&countingReader{r: bytes.NewReader(dat)}, dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c4.Dir() == c.Dir() {
+		t.Fatal("modified source has the same identity")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	dir := t.TempDir()
+	dat := make([]byte, 64*1024)
+	op := DefaultOptions()
+	op.ChunkSize = 1024
+	op.MaxSize = 16 * 1024
+	c, err := New(bytes.NewReader(dat), dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files that aren't chunks must be left alone, even if they're older than every chunk.
+	others := []string{
+		filepath.Join(dir, "unrelated.txt"),
+		filepath.Join(dir, "notes", "0"),
+		filepath.Join(c.Dir(), ".tmp-123"),
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, p := range others {
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, make([]byte, op.MaxSize), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(p, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = c.ReadAt(make([]byte, len(dat)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Evict()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ents, err := os.ReadDir(c.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, e := range ents {
+		info, err := e.Info()
+		if err != nil || !isChunkName(e.Name()) {
+			continue
+		}
+		total += info.Size()
+	}
+	if total > op.MaxSize {
+		t.Fatal("cache is", total, "bytes after eviction")
+	}
+	for _, p := range others {
+		_, err = os.Stat(p)
+		if err != nil {
+			t.Fatal("evicting removed a file that isn't a chunk:", err)
+		}
+	}
+	// Evicted data should be fetched again.
+	buf := make([]byte, len(dat))
+	_, err = c.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, dat) {
+		t.Fatal("data mismatch after eviction")
+	}
+}
+
+func TestShortChunks(t *testing.T) {
+	dir := t.TempDir()
+	dat := make([]byte, 2500)
+	rand.New(rand.NewSource(42)).Read(dat)
+	op := DefaultOptions()
+	op.ChunkSize = 1024
+	c, err := New(bytes.NewReader(dat), dir, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reads at and past the end shouldn't leave empty chunks behind.
+	for _, off := range []int64{3 * op.ChunkSize, 10 * op.ChunkSize} {
+		n, err := c.ReadAt(make([]byte, 10), off)
+		if n != 0 || err != io.EOF {
+			t.Fatal("read", n, "bytes with", err, "at offset", off)
+		}
+		if _, err = os.Stat(c.chunkPath(off / op.ChunkSize)); err == nil {
+			t.Fatal("chunk", off/op.ChunkSize, "was cached after reading past the end")
+		}
+	}
+	// The final partial chunk is real data and should be cached.
+	buf := make([]byte, 100)
+	n, err := c.ReadAt(buf, int64(len(dat))-100)
+	if n != 100 || err != nil {
+		t.Fatal("read", n, "bytes with", err)
+	}
+	last, err := os.ReadFile(c.chunkPath(int64(len(dat)) / op.ChunkSize))
+	if err != nil {
+		t.Fatal("final chunk wasn't cached:", err)
+	}
+	if !bytes.Equal(last, dat[2*op.ChunkSize:]) {
+		t.Fatal("final chunk has the wrong data")
+	}
+}
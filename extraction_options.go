@@ -3,6 +3,8 @@ package squashfs
 import (
 	"io"
 	"io/fs"
+	"log/slog"
+	"os"
 	"runtime"
 	"sync"
 )
@@ -10,10 +12,12 @@ import (
 type ExtractionOptions struct {
 	dispatcher         chan struct{} // Limits the amount of work being done simultaneously.
 	fullRdrPool        sync.Pool     // Pool for data.FullReader results.
-	LogOutput          io.Writer     //Where the verbose log should write.
+	log                *slog.Logger  // The logger used. Set on the first call to ExtractWithOptions.
+	Logger             *slog.Logger  //Receives an event for each failure, skipped file, and (at debug level) extracted file. Defaults to the Reader's logger.
+	LogOutput          io.Writer     //Where the verbose log should write if Logger isn't set. Defaults to os.Stderr.
 	DereferenceSymlink bool          //Replace symlinks with the target file.
 	UnbreakSymlink     bool          //Try to make sure symlinks remain unbroken when extracted, without changing the symlink.
-	Verbose            bool          //Prints extra info to log on an error.
+	Verbose            bool          //If Logger isn't set, logs all events as text to LogOutput.
 	IgnorePerm         bool          //Ignore file's permissions and instead use Perm.
 	Perm               fs.FileMode   //Permission to use when IgnorePerm. Defaults to 0777.
 	ExtractionRoutines uint16        //The number of threads to use during extraction. Defaults to a number based on runtime.NumCPU().
@@ -24,7 +28,7 @@ type ExtractionOptions struct {
 func DefaultOptions() *ExtractionOptions {
 	return &ExtractionOptions{
 		Perm:               0777,
-		ExtractionRoutines: uint16(runtime.NumCPU() / 2),
+		ExtractionRoutines: uint16(max(runtime.NumCPU()/2, 1)),
 	}
 }
 
@@ -35,3 +39,18 @@ func FastOptions() *ExtractionOptions {
 		ExtractionRoutines: uint16(runtime.NumCPU()),
 	}
 }
+
+// Returns the logger extraction events are sent to.
+func (op *ExtractionOptions) logger(r *Reader) *slog.Logger {
+	if op.Logger != nil {
+		return op.Logger
+	}
+	if op.Verbose {
+		out := op.LogOutput
+		if out == nil {
+			out = os.Stderr
+		}
+		return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return r.Low.Logger()
+}
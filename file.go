@@ -4,16 +4,19 @@ import (
 	"errors"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/CalebQ42/squashfs/internal/fileattr"
 	squashfslow "github.com/CalebQ42/squashfs/low"
 	"github.com/CalebQ42/squashfs/low/data"
+	"github.com/CalebQ42/squashfs/low/directory"
 	"github.com/CalebQ42/squashfs/low/inode"
 )
 
@@ -25,6 +28,7 @@ type File struct {
 	parent   FS
 	r        *Reader
 	Low      squashfslow.FileBase
+	dirEnts  []directory.Entry // Cached by ReadDir.
 	dirsRead int
 }
 
@@ -64,16 +68,27 @@ func (f File) GetSymlinkFile() fs.File {
 	if !f.IsSymlink() {
 		return nil
 	}
-	if filepath.IsAbs(f.SymlinkPath()) {
+	if strings.HasPrefix(f.SymlinkPath(), "/") {
 		return nil
 	}
-	fil, err := f.parent.Open(f.SymlinkPath())
+	fil, err := f.parent.open(f.SymlinkPath())
 	if err != nil {
 		return nil
 	}
 	return fil
 }
 
+// Returns the directory containing the file. The parent is found using the file's inode number, so this works even if the
+// File wasn't opened from it's parent, such as from OpenInode or a Sub FS. If the file is hard linked, only one of it's
+// parents is returned. Returns an error if the file is the archive's root directory.
+func (f File) Parent() (*File, error) {
+	num, err := f.r.Low.ParentNum(f.Low.Inode.Num)
+	if err != nil {
+		return nil, err
+	}
+	return f.r.OpenInode(num)
+}
+
 // Returns whether the file is a directory.
 func (f File) IsDir() bool {
 	return f.Low.IsDir()
@@ -94,7 +109,11 @@ func (f File) Mode() fs.FileMode {
 }
 
 // Read reads the data from the file. Only works if file is a normal file.
+// Devices, fifos, and sockets have no data, so always return io.EOF.
 func (f *File) Read(b []byte) (int, error) {
+	if f.isSpecial() {
+		return 0, io.EOF
+	}
 	if !f.IsRegular() {
 		return 0, errors.New("file is not a regular file")
 	}
@@ -107,36 +126,54 @@ func (f *File) Read(b []byte) (int, error) {
 	return f.rdr.Read(b)
 }
 
-// ReadDir returns n fs.DirEntry's that's contained in the File (if it's a directory).
-// If n <= 0 all fs.DirEntry's are returned.
+// Seek sets the offset of the next Read, such as for http.ServeContent. Only works if file is a normal file.
+// Devices, fifos, and sockets have no data, so their offset is always 0.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.isSpecial() {
+		return 0, nil
+	}
+	if !f.IsRegular() {
+		return 0, errors.New("file is not a regular file")
+	}
+	if !f.rdrInit {
+		err := f.initializeReaders()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return f.rdr.Seek(offset, whence)
+}
+
+// ReadDir returns the next n fs.DirEntry's that's contained in the File (if it's a directory).
+// If n <= 0 all remaining fs.DirEntry's are returned. Otherwise, io.EOF is returned once there are no more entries.
+// The returned entries are *DirEntry, which only read the file's inode if Info is called.
 func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
 	if !f.IsDir() {
 		return nil, errors.New("file is not a directory")
 	}
-	d, err := f.Low.ToDir(f.r.Low)
-	if err != nil {
-		return nil, err
+	if f.dirEnts == nil {
+		d, err := f.Low.ToDir(f.r.Low)
+		if err != nil {
+			return nil, err
+		}
+		f.dirEnts = d.Entries
+		if f.dirEnts == nil {
+			f.dirEnts = []directory.Entry{}
+		}
 	}
-	start, end := 0, len(d.Entries)
+	remaining := f.dirEnts[f.dirsRead:]
 	if n > 0 {
-		start, end = f.dirsRead, f.dirsRead+n
-		if end > len(d.Entries) {
-			end = len(d.Entries)
-			err = io.EOF
+		if len(remaining) == 0 {
+			return nil, io.EOF
 		}
+		remaining = remaining[:min(n, len(remaining))]
 	}
-	var out []fs.DirEntry
-	var fi FileInfo
-	for _, e := range d.Entries[start:end] {
-		fi, err = f.r.newFileInfo(e)
-		if err != nil {
-			f.dirsRead += len(out)
-			return out, err
-		}
-		out = append(out, fs.FileInfoToDirEntry(fi))
+	out := make([]fs.DirEntry, len(remaining))
+	for i := range remaining {
+		out[i] = &DirEntry{e: remaining[i], r: f.r}
 	}
-	f.dirsRead += len(out)
-	return out, err
+	f.dirsRead += len(remaining)
+	return out, nil
 }
 
 // Returns the file's fs.FileInfo
@@ -163,9 +200,17 @@ func (f File) SymlinkPath() string {
 	return ""
 }
 
-// Writes all data from the file to the given writer in a multi-threaded manner.
-// The underlying reader is separate
+// Returns the file's extended attributes. Returns nil if it doesn't have any.
+func (f File) Xattrs() ([]squashfslow.Xattr, error) {
+	return f.Low.Xattrs(&f.r.Low)
+}
+
+// Writes the file's data, from the current position, to the given writer and advances the position past it.
+// If nothing's been read yet, the data is read in a multi-threaded manner.
 func (f *File) WriteTo(w io.Writer) (int64, error) {
+	if f.isSpecial() {
+		return 0, nil
+	}
 	if !f.IsRegular() {
 		return 0, errors.New("file is not a regular file")
 	}
@@ -175,7 +220,16 @@ func (f *File) WriteTo(w io.Writer) (int64, error) {
 			return 0, err
 		}
 	}
-	return f.full.WriteTo(w)
+	pos, err := f.rdr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if pos != 0 {
+		return io.Copy(w, &f.rdr)
+	}
+	n, err := f.full.WriteTo(w)
+	_, seekErr := f.rdr.Seek(n, io.SeekStart)
+	return n, errors.Join(err, seekErr)
 }
 
 func (f *File) initializeReaders() error {
@@ -183,6 +237,7 @@ func (f *File) initializeReaders() error {
 	f.rdr, f.full, err = f.Low.GetRegFileReaders(f.r.Low)
 	if err == nil {
 		f.rdrInit = true
+		f.r.access.record(f.path())
 	} else {
 		f.rdr.Close()
 		f.full.Close()
@@ -190,6 +245,15 @@ func (f *File) initializeReaders() error {
 	return err
 }
 
+// Returns whether the file is a device, fifo, or socket.
+func (f File) isSpecial() bool {
+	switch f.Low.Inode.Type {
+	case inode.Char, inode.EChar, inode.Block, inode.EBlock, inode.Fifo, inode.EFifo, inode.Sock, inode.ESock:
+		return true
+	}
+	return false
+}
+
 func (f File) deviceDevices() (maj uint32, min uint32) {
 	var dev uint32
 	switch f.Low.Inode.Type {
@@ -205,7 +269,7 @@ func (f File) path() string {
 	if f.parent.LowDir.Name == "" {
 		return f.Low.Name
 	}
-	return filepath.Join(f.parent.path(), f.Low.Name)
+	return f.parent.path() + "/" + f.Low.Name
 }
 
 // Extract the file to the given folder. If the file is a folder, the folder's contents will be extracted to the folder.
@@ -227,14 +291,10 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		for range op.ExtractionRoutines {
 			op.dispatcher <- struct{}{}
 		}
-		if op.LogOutput != nil {
-			log.SetOutput(op.LogOutput)
-		}
+		op.log = op.logger(f.r)
 		err := os.MkdirAll(path, 0777)
 		if err != nil {
-			if op.Verbose {
-				log.Println("Failed to create initial directory", path)
-			}
+			f.logFailure(op, "mkdir", path, err)
 			return err
 		}
 	}
@@ -243,9 +303,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		<-op.dispatcher
 		d, err := f.Low.ToDir(f.r.Low)
 		if err != nil {
-			if op.Verbose {
-				log.Println("Failed to create squashfs.Directory for", path)
-			}
+			f.logFailure(op, "read directory", path, err)
 			op.dispatcher <- struct{}{}
 			return errors.Join(errors.New("failed to create squashfs.Directory: "+path), err)
 		}
@@ -253,9 +311,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		for i := range d.Entries {
 			b, err := f.r.Low.BaseFromEntry(d.Entries[i])
 			if err != nil {
-				if op.Verbose {
-					log.Println("Failed to get squashfs.Base from entry for", path)
-				}
+				f.logFailure(op, "read inode", filepath.Join(path, d.Entries[i].Name), err)
 				return errors.Join(errors.New("failed to get base from entry: "+path), err)
 			}
 			go func(b squashfslow.FileBase, path string) {
@@ -264,9 +320,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 					extDir := filepath.Join(path, b.Name)
 					err = os.Mkdir(extDir, 0777)
 					if err != nil {
-						if op.Verbose {
-							log.Println("Failed to create directory", path)
-						}
+						f.logFailure(op, "mkdir", extDir, err)
 						op.dispatcher <- struct{}{}
 						errChan <- errors.Join(errors.New("failed to create directory: "+path), err)
 						return
@@ -275,9 +329,6 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 					op.dispatcher <- struct{}{}
 					err = fil.ExtractWithOptions(extDir, op)
 					if err != nil {
-						if op.Verbose {
-							log.Println("Failed to extract directory", path)
-						}
 						errChan <- errors.Join(errors.New("failed to extract directory: "+path), err)
 						return
 					}
@@ -306,9 +357,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		path = filepath.Join(path, f.Low.Name)
 		outFil, err := os.Create(path)
 		if err != nil {
-			if op.Verbose {
-				log.Println("Failed to create file", path)
-			}
+			f.logFailure(op, "create", path, err)
 			op.dispatcher <- struct{}{}
 			return errors.Join(errors.New("failed to create file: "+path), err)
 		}
@@ -316,9 +365,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		full, err := f.Low.GetFullReader(&f.r.Low)
 		defer full.Close()
 		if err != nil {
-			if op.Verbose {
-				log.Println("Failed to create full reader for", path)
-			}
+			f.logFailure(op, "read file", path, err)
 			op.dispatcher <- struct{}{}
 			return errors.Join(errors.New("failed to create full reader: "+path), err)
 		}
@@ -326,9 +373,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		op.dispatcher <- struct{}{}
 		_, err = full.WriteTo(outFil)
 		if err != nil {
-			if op.Verbose {
-				log.Println("Failed to write file", path)
-			}
+			f.logFailure(op, "write", path, err)
 			return errors.Join(errors.New("failed to write file: "+path), err)
 		}
 	case inode.Sym, inode.ESym:
@@ -338,45 +383,38 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		if op.DereferenceSymlink {
 			filTmp := f.GetSymlinkFile()
 			if filTmp == nil {
-				if op.Verbose {
-					log.Println("Failed to get symlink's file:", f.path())
-				}
-				return errors.New("failed to get symlink's file")
+				err := errors.New("failed to get symlink's file")
+				f.logFailure(op, "dereference symlink", filepath.Join(path, f.Low.Name), err)
+				return err
 			}
 			fil := filTmp.(*File)
 			fil.Low.Name = f.Low.Name
 			err := fil.ExtractWithOptions(path, op)
 			if err != nil {
-				if op.Verbose {
-					log.Println("Failed to extract symlink's file:", filepath.Join(path, f.Low.Name))
-				}
 				return errors.Join(errors.New("failed to extract symlink's file: "+path), err)
 			}
+			// The target's extraction already set it's permissions and times.
+			return nil
 		} else {
 			if op.UnbreakSymlink {
 				filTmp := f.GetSymlinkFile()
 				if filTmp == nil {
-					if op.Verbose {
-						log.Println("Failed to get symlink's file:", f.path())
-					}
-					return errors.New("failed to get symlink's file")
+					err := errors.New("failed to get symlink's file")
+					f.logFailure(op, "unbreak symlink", filepath.Join(path, f.Low.Name), err)
+					return err
 				}
 				extractLoc := filepath.Join(path, filepath.Dir(symPath))
 				fil := filTmp.(*File)
 				err := fil.ExtractWithOptions(extractLoc, op)
 				if err != nil {
-					if op.Verbose {
-						log.Println("Error while extracting", fil.path(), "to make sure symlink at", f.path(), "is unbroken")
-					}
+					f.logFailure(op, "unbreak symlink", filepath.Join(path, f.Low.Name), err)
 					return errors.Join(errors.New("failed to extract symlink's file: "+extractLoc), err)
 				}
 			}
 			path = filepath.Join(path, f.Low.Name)
 			err := os.Symlink(f.SymlinkPath(), path)
 			if err != nil {
-				if op.Verbose {
-					log.Println("Failed to create symlink:", path)
-				}
+				f.logFailure(op, "symlink", path, err)
 				return errors.Join(errors.New("failed to create symlink: "+path), err)
 			}
 		}
@@ -384,16 +422,12 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 		<-op.dispatcher
 		defer func() { op.dispatcher <- struct{}{} }()
 		if runtime.GOOS == "windows" {
-			if op.Verbose {
-				log.Println(f.path(), "ignored. A device link and can't be created on Windows.")
-			}
+			f.logSkip(op, "device files can't be created on Windows", filepath.Join(path, f.Low.Name))
 			return nil
 		}
 		_, err := exec.LookPath("mknod")
 		if err != nil {
-			if op.Verbose {
-				log.Println("mknot command not found, cannot create device link for", f.path())
-			}
+			f.logFailure(op, "mknod", filepath.Join(path, f.Low.Name), err)
 			return errors.Join(errors.New("mknot command not found"), err)
 		}
 		path = filepath.Join(path, f.Low.Name)
@@ -405,9 +439,7 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 			typ = "b"
 		default: //Fifo IPC
 			if runtime.GOOS == "darwin" {
-				if op.Verbose {
-					log.Println(f.path(), "ignored. A Fifo file and can't be created on Darwin.")
-				}
+				f.logSkip(op, "fifos can't be created on Darwin", path)
 				return nil
 			}
 			typ = "p"
@@ -417,48 +449,49 @@ func (f File) ExtractWithOptions(path string, op *ExtractionOptions) error {
 			maj, min := f.deviceDevices()
 			cmd.Args = append(cmd.Args, strconv.Itoa(int(maj)), strconv.Itoa(int(min)))
 		}
-		if op.Verbose {
-			cmd.Stdout = op.LogOutput
-			cmd.Stderr = op.LogOutput
-		}
-		err = cmd.Run()
+		out, err := cmd.CombinedOutput()
 		if err != nil {
-			if op.Verbose {
-				log.Println("Error while running mknod for", path)
-			}
+			f.logFailure(op, "mknod", path, err, slog.String("output", string(out)))
 			return errors.Join(errors.New("error while running mknod for "+path), err)
 		}
 	case inode.Sock, inode.ESock:
-		if op.Verbose {
-			log.Println(f.path(), "ignored since it's a socket file.")
-		}
+		f.logSkip(op, "sockets aren't extracted", filepath.Join(path, f.Low.Name))
 		return nil
 	default:
 		return errors.New("Unsupported file type. Inode type: " + strconv.Itoa(int(f.Low.Inode.Type)))
 	}
-	if op.Verbose {
-		log.Println(f.path(), "extracted to", path)
-	}
+	op.log.Debug("extracted", "op", "extract", "path", path, "inode", f.Low.Inode.Num, "archive_path", f.path())
 	if op.IgnorePerm {
+		err := fileattr.SetModTime(path, f.Low.Inode)
+		if err != nil {
+			f.logFailure(op, "chtimes", path, err)
+		}
 		return nil
 	}
 	uid, err := f.Low.Uid(&f.r.Low)
 	if err != nil {
-		if op.Verbose {
-			log.Println("Failed to get uid for", path)
-			log.Println(err)
-		}
+		f.logFailure(op, "get uid", path, err)
 		return nil
 	}
 	gid, err := f.Low.Gid(&f.r.Low)
 	if err != nil {
-		if op.Verbose {
-			log.Println("Failed to get gid for", path)
-			log.Println(err)
-		}
+		f.logFailure(op, "get gid", path, err)
 		return nil
 	}
-	os.Chmod(path, f.Mode())
-	os.Chown(path, int(uid), int(gid))
+	fileattr.SetPerm(path, f.Low.Inode, int(uid), int(gid))
+	err = fileattr.SetModTime(path, f.Low.Inode)
+	if err != nil {
+		f.logFailure(op, "chtimes", path, err)
+	}
 	return nil
 }
+
+// Logs an extraction operation that failed. The error is also returned by ExtractWithOptions.
+func (f File) logFailure(op *ExtractionOptions, action, path string, err error, attrs ...any) {
+	op.log.Error("extraction failed", append([]any{"op", action, "path", path, "inode", f.Low.Inode.Num, "error", err}, attrs...)...)
+}
+
+// Logs a file that's intentionally not extracted.
+func (f File) logSkip(op *ExtractionOptions, reason, path string) {
+	op.log.Warn("file skipped", "op", "extract", "path", path, "inode", f.Low.Inode.Num, "reason", reason)
+}
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"time"
 
+	squashfslow "github.com/CalebQ42/squashfs/low"
 	"github.com/CalebQ42/squashfs/low/directory"
 	"github.com/CalebQ42/squashfs/low/inode"
 )
@@ -17,6 +18,8 @@ type FileInfo struct {
 	perm     uint32
 	modTime  uint32
 	fileType uint16
+	num      uint32
+	links    uint32
 }
 
 func (r Reader) newFileInfo(e directory.Entry) (FileInfo, error) {
@@ -24,6 +27,10 @@ func (r Reader) newFileInfo(e directory.Entry) (FileInfo, error) {
 	if err != nil {
 		return FileInfo{}, err
 	}
+	return r.fileInfoFromBase(b)
+}
+
+func (r Reader) fileInfoFromBase(b squashfslow.FileBase) (FileInfo, error) {
 	uid, err := b.Uid(&r.Low)
 	if err != nil {
 		return FileInfo{}, err
@@ -32,7 +39,7 @@ func (r Reader) newFileInfo(e directory.Entry) (FileInfo, error) {
 	if err != nil {
 		return FileInfo{}, err
 	}
-	return newFileInfo(e.Name, uid, gid, &b.Inode), nil
+	return newFileInfo(b.Name, uid, gid, &b.Inode), nil
 }
 
 func newFileInfo(name string, uid, gid uint32, i *inode.Inode) FileInfo {
@@ -57,6 +64,8 @@ func newFileInfo(name string, uid, gid uint32, i *inode.Inode) FileInfo {
 		perm:     uint32(i.Perm),
 		modTime:  i.ModTime,
 		fileType: i.Type,
+		num:      i.Num,
+		links:    i.LinkCount(),
 	}
 }
 
@@ -72,6 +81,17 @@ func (f FileInfo) Gid() int {
 	return int(f.gid)
 }
 
+// Returns the file's inode number. Hard links share the same inode number.
+func (f FileInfo) Inode() uint32 {
+	return f.num
+}
+
+// Returns the number of hard links to the file. For directories, this includes the directory's entry in it's parent,
+// it's "." entry, and the ".." entry of each sub-directory.
+func (f FileInfo) LinkCount() uint32 {
+	return f.links
+}
+
 func (f FileInfo) Size() int64 {
 	return f.size
 }
@@ -124,3 +144,53 @@ func (f FileInfo) IsSocket() bool {
 func (f FileInfo) Sys() any {
 	return nil
 }
+
+// A fs.DirEntry returned by File.ReadDir. Name, IsDir, and Type only use the directory entry,
+// so the file's inode is only read when Info is called.
+type DirEntry struct {
+	r *Reader
+	e directory.Entry
+	b *squashfslow.FileBase // Cached by base.
+}
+
+func (d *DirEntry) Name() string {
+	return d.e.Name
+}
+
+func (d *DirEntry) IsDir() bool {
+	return d.e.InodeType == inode.Dir || d.e.InodeType == inode.EDir
+}
+
+func (d *DirEntry) Type() fs.FileMode {
+	return inode.Inode{Header: inode.Header{Type: d.e.InodeType}}.Mode().Type()
+}
+
+// Reads the file's inode and returns it's FileInfo.
+func (d *DirEntry) Info() (fs.FileInfo, error) {
+	b, err := d.base()
+	if err != nil {
+		return nil, err
+	}
+	return d.r.fileInfoFromBase(b)
+}
+
+// Returns the file's inode, reading it the first time it's needed.
+func (d *DirEntry) base() (squashfslow.FileBase, error) {
+	if d.b == nil {
+		b, err := d.r.Low.BaseFromEntry(d.e)
+		if err != nil {
+			return b, err
+		}
+		d.b = &b
+	}
+	return *d.b, nil
+}
+
+// Returns the underlying directory entry.
+func (d *DirEntry) Entry() directory.Entry {
+	return d.e
+}
+
+func (d *DirEntry) String() string {
+	return fs.FormatDirEntry(d)
+}
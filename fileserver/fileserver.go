@@ -0,0 +1,343 @@
+// Package fileserver provides an http.Handler that serves the files in a squashfs archive.
+// Range requests, conditional requests, and Content-Type detection are handled by http.ServeContent. ETags are made from
+// each file's inode number, size, and modification time, so they stay the same as long as the archive does.
+//
+// Directories are served as their index.html if they have one, otherwise as a listing. A listing is HTML unless the
+// request's Accept header includes application/json or the URL has a format=json query, in which case it's JSON.
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+// The maximum number of symlinks followed for a single request, the same as Linux.
+const maxLinks = 40
+
+// How symlinks are served.
+type SymlinkPolicy int
+
+const (
+	// Serve the file the symlink points to.
+	SymlinkFollow SymlinkPolicy = iota
+	// Redirect to the file the symlink points to.
+	SymlinkRedirect
+	// Respond with 403 Forbidden to any path containing a symlink.
+	SymlinkDeny
+)
+
+// Parses a SymlinkPolicy from "follow", "redirect", or "deny".
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch s {
+	case "follow":
+		return SymlinkFollow, nil
+	case "redirect":
+		return SymlinkRedirect, nil
+	case "deny":
+		return SymlinkDeny, nil
+	}
+	return 0, errors.New("unknown symlink policy: " + s)
+}
+
+type Options struct {
+	// How symlinks are served. Symlinks with absolute targets, or that point outside the archive, are always treated as missing.
+	Symlinks SymlinkPolicy
+	// Respond with 403 Forbidden instead of listing directories without an index.html.
+	NoListing bool
+}
+
+// Handler is an http.Handler that serves the files of a squashfs.FS.
+type Handler struct {
+	fsys squashfs.FS
+	op   Options
+}
+
+// Creates a Handler for fsys that follows symlinks and lists directories. A Reader's FS can be served with New(r.FS).
+func New(fsys squashfs.FS) *Handler {
+	return NewWithOptions(fsys, Options{})
+}
+
+func NewWithOptions(fsys squashfs.FS, op Options) *Handler {
+	return &Handler{
+		fsys: fsys,
+		op:   op,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+	fil, target, err := h.open(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if target != "" {
+		// The Location is relative so the handler can be used with http.StripPrefix.
+		from := path.Dir(name)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			from = name
+		}
+		loc := relURL(from, target)
+		if strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(loc, "/") {
+			loc += "/"
+		}
+		localRedirect(w, r, loc, http.StatusFound)
+		return
+	}
+	defer fil.Close()
+	if fil.IsDir() {
+		if name != "." && !strings.HasSuffix(r.URL.Path, "/") {
+			localRedirect(w, r, path.Base(name)+"/", http.StatusMovedPermanently)
+			return
+		}
+		index, err := h.fsys.OpenFile(path.Join(name, "index.html"))
+		if err == nil {
+			defer index.Close()
+			if index.IsRegular() {
+				h.serveFile(w, r, index)
+				return
+			}
+		}
+		h.serveDir(w, r, fil)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		localRedirect(w, r, "../"+path.Base(name), http.StatusMovedPermanently)
+		return
+	}
+	if !fil.IsRegular() {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+	h.serveFile(w, r, fil)
+}
+
+// Opens the file at name following the Handler's SymlinkPolicy. If the policy is SymlinkRedirect and name contains
+// a symlink, returns the path to redirect to instead.
+func (h *Handler) open(name string) (fil *squashfs.File, target string, err error) {
+	done := "."
+	rest := name
+	if rest == "." {
+		rest = ""
+	}
+	links := 0
+	for rest != "" {
+		var part string
+		part, rest, _ = strings.Cut(rest, "/")
+		cur := path.Join(done, part)
+		// Only used to check for symlinks. The file that's returned is opened again at the end.
+		step, err := h.fsys.OpenFile(cur)
+		if err != nil {
+			return nil, "", err
+		}
+		isLink, linkTarget := step.IsSymlink(), step.SymlinkPath()
+		step.Close()
+		if !isLink {
+			done = cur
+			continue
+		}
+		if h.op.Symlinks == SymlinkDeny {
+			return nil, "", fs.ErrPermission
+		}
+		target = linkTarget
+		if strings.HasPrefix(target, "/") {
+			return nil, "", fs.ErrNotExist
+		}
+		target = path.Join(path.Dir(cur), target)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return nil, "", fs.ErrNotExist
+		}
+		if rest != "" {
+			target = path.Join(target, rest)
+		}
+		if h.op.Symlinks == SymlinkRedirect {
+			return nil, target, nil
+		}
+		links++
+		if links > maxLinks {
+			return nil, "", errors.New("too many levels of symbolic links")
+		}
+		done, rest = ".", target
+		if rest == "." {
+			rest = ""
+		}
+	}
+	fil, err = h.fsys.OpenFile(done)
+	return fil, "", err
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, fil *squashfs.File) {
+	info, err := fil.Stat()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(fil, info, ""))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), fil)
+}
+
+// An entry of a JSON directory listing.
+type listEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Mode    string    `json:"mode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Target  string    `json:"target,omitempty"`
+}
+
+func (h *Handler) serveDir(w http.ResponseWriter, r *http.Request, dir *squashfs.File) {
+	if h.op.NoListing {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+	info, err := dir.Stat()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	ents, err := dir.ReadDir(-1)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	list := make([]listEntry, len(ents))
+	for i, e := range ents {
+		entInfo, err := e.Info()
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		list[i] = listEntry{
+			Name:    e.Name(),
+			Type:    typeName(e.Type()),
+			Mode:    fmt.Sprintf("%04o", entInfo.Mode().Perm()),
+			Size:    entInfo.Size(),
+			ModTime: entInfo.ModTime().UTC(),
+		}
+		if sfi, ok := entInfo.(squashfs.FileInfo); ok {
+			list[i].Target = sfi.SymlinkPath()
+		}
+	}
+	var buf bytes.Buffer
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(dir, info, "json"))
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(list)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("ETag", etag(dir, info, "html"))
+		buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+		for _, e := range list {
+			name := e.Name
+			if e.Type == "dir" {
+				name += "/"
+			}
+			// Names may contain ':', which would otherwise be taken as a URL scheme.
+			u := url.URL{Path: name}
+			fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(name))
+		}
+		buf.WriteString("</pre>\n")
+	}
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(buf.Bytes()))
+}
+
+// Returns a strong ETag made of the file's inode number, size, and modification time. variant separates different
+// representations of the same file, such as a directory's HTML and JSON listings.
+func etag(fil *squashfs.File, info fs.FileInfo, variant string) string {
+	tag := strconv.FormatUint(uint64(fil.Low.Inode.Num), 16) + "-" + strconv.FormatInt(info.Size(), 16) + "-" +
+		strconv.FormatInt(info.ModTime().Unix(), 16)
+	if variant != "" {
+		tag += "-" + variant
+	}
+	return `"` + tag + `"`
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func typeName(t fs.FileMode) string {
+	switch {
+	case t&fs.ModeDir != 0:
+		return "dir"
+	case t&fs.ModeSymlink != 0:
+		return "symlink"
+	case t&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case t&fs.ModeSocket != 0:
+		return "socket"
+	case t&fs.ModeDevice != 0:
+		return "device"
+	}
+	return "file"
+}
+
+// Returns a relative URL from the directory from to the path to. Both are slash separated paths relative to the archive's root.
+func relURL(from, to string) string {
+	var fromParts, toParts []string
+	if from != "." {
+		fromParts = strings.Split(from, "/")
+	}
+	if to != "." {
+		toParts = strings.Split(to, "/")
+	}
+	common := 0
+	for common < len(fromParts) && common < len(toParts) && fromParts[common] == toParts[common] {
+		common++
+	}
+	rel := strings.Repeat("../", len(fromParts)-common) + strings.Join(toParts[common:], "/")
+	if rel == "" {
+		rel = "./"
+	}
+	u := url.URL{Path: rel}
+	return u.String()
+}
+
+// Redirects to a relative location, keeping the request's query. Unlike http.Redirect, the location isn't made absolute
+// so it's still correct behind http.StripPrefix.
+func localRedirect(w http.ResponseWriter, r *http.Request, loc string, code int) {
+	if q := r.URL.RawQuery; q != "" {
+		loc += "?" + q
+	}
+	w.Header().Set("Location", loc)
+	w.WriteHeader(code)
+}
+
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,180 @@
+package fileserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/internal/testarchive"
+)
+
+const filePath = testarchive.FilePath
+
+// Opens testdata/web.sqfs. It has files/a.txt, link -> files, alink -> files/a.txt, escape -> ../outside, and
+// abs -> /files/a.txt. Every file's modification time is 1700000000.
+func openWeb(t *testing.T) squashfs.Reader {
+	rdr, err := squashfs.OpenFile(filepath.Join("testdata", "web.sqfs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdr.Close() })
+	return rdr
+}
+
+func get(h http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServe(t *testing.T) {
+	rdr, err := squashfs.NewReader(testarchive.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(rdr.FS)
+	want, err := rdr.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := get(h, "/"+filePath, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatal("status", rec.Code)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Fatal("body isn't the same as", filePath)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	rec = get(h, "/"+filePath, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified {
+		t.Fatal("status", rec.Code, "with a matching ETag")
+	}
+	rec = get(h, "/"+filePath, map[string]string{"Range": "bytes=1-10"})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatal("status", rec.Code, "for a range")
+	}
+	if !bytes.Equal(rec.Body.Bytes(), want[1:11]) {
+		t.Fatal("wrong range")
+	}
+	rec = get(h, "/"+path.Dir(filePath), nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != path.Base(path.Dir(filePath))+"/" {
+		t.Fatal("directory without a slash isn't redirected")
+	}
+	rec = get(h, "/"+path.Dir(filePath)+"/", map[string]string{"Accept": "application/json"})
+	if rec.Code != http.StatusOK {
+		t.Fatal("status", rec.Code, "for a listing")
+	}
+	var list []listEntry
+	err = json.Unmarshal(rec.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range list {
+		found = found || e.Name == path.Base(filePath)
+	}
+	if !found {
+		t.Fatal(path.Base(filePath), "isn't in the listing")
+	}
+	rec = get(h, "/does/not/exist", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatal("status", rec.Code, "for a missing file")
+	}
+}
+
+func TestSymlinkPolicies(t *testing.T) {
+	rdr := openWeb(t)
+	type result struct {
+		code int
+		body string // The body if code is 200, the Location if it's a redirect.
+	}
+	for _, c := range []struct {
+		policy SymlinkPolicy
+		want   map[string]result
+	}{
+		{SymlinkFollow, map[string]result{
+			"/files/a.txt": {http.StatusOK, "a\n"},
+			"/link/a.txt":  {http.StatusOK, "a\n"},
+			"/alink":       {http.StatusOK, "a\n"},
+			"/escape":      {http.StatusNotFound, ""},
+			"/abs":         {http.StatusNotFound, ""},
+		}},
+		{SymlinkRedirect, map[string]result{
+			"/files/a.txt": {http.StatusOK, "a\n"},
+			"/link/a.txt":  {http.StatusFound, "../files/a.txt"},
+			"/link/":       {http.StatusFound, "../files/"},
+			"/alink":       {http.StatusFound, "files/a.txt"},
+			"/escape":      {http.StatusNotFound, ""},
+			"/abs":         {http.StatusNotFound, ""},
+		}},
+		{SymlinkDeny, map[string]result{
+			"/files/a.txt": {http.StatusOK, "a\n"},
+			"/link/a.txt":  {http.StatusForbidden, ""},
+			"/alink":       {http.StatusForbidden, ""},
+			"/escape":      {http.StatusForbidden, ""},
+		}},
+	} {
+		h := NewWithOptions(rdr.FS, Options{Symlinks: c.policy})
+		for target, want := range c.want {
+			rec := get(h, target, nil)
+			got := result{code: rec.Code}
+			switch rec.Code {
+			case http.StatusOK:
+				got.body = rec.Body.String()
+			case http.StatusFound:
+				got.body = rec.Header().Get("Location")
+			}
+			if got != want {
+				t.Error("policy", c.policy, target, "returned", got, "instead of", want)
+			}
+		}
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	h := New(openWeb(t).FS)
+	mod := time.Unix(1700000000, 0)
+	for _, c := range []struct {
+		since time.Time
+		want  int
+	}{
+		{mod, http.StatusNotModified},
+		{mod.Add(time.Hour), http.StatusNotModified},
+		{mod.Add(-time.Hour), http.StatusOK},
+	} {
+		for _, target := range []string{"/files/a.txt", "/link/a.txt", "/files/"} {
+			rec := get(h, target, map[string]string{"If-Modified-Since": c.since.UTC().Format(http.TimeFormat)})
+			if rec.Code != c.want {
+				t.Error(target, "returned", rec.Code, "instead of", c.want, "when modified since", c.since)
+			}
+		}
+	}
+}
+
+func TestRelURL(t *testing.T) {
+	for _, c := range []struct{ from, to, want string }{
+		{".", "usr/lib", "usr/lib"},
+		{"lib", "usr/lib/libfoo.so", "../usr/lib/libfoo.so"},
+		{"usr/bin", "usr/lib/libfoo.so", "../lib/libfoo.so"},
+		{"usr", ".", "../"},
+		{"usr", "usr", "./"},
+		{".", "a:b", "./a:b"},
+	} {
+		if got := relURL(c.from, c.to); got != c.want {
+			t.Error("relURL", c.from, c.to, "is", got, "instead of", c.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package squashfs
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/squashfs/internal/pathmatch"
+	squashfslow "github.com/CalebQ42/squashfs/low"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// A set of file types. Used by Query.
+type FileType uint8
+
+const (
+	TypeRegular = FileType(1 << iota)
+	TypeDir
+	TypeSymlink
+	TypeDevice // Block and character devices.
+	TypeFifo
+	TypeSocket
+)
+
+func fileTypeOf(inodeType uint16) FileType {
+	switch inodeType {
+	case inode.Fil, inode.EFil:
+		return TypeRegular
+	case inode.Dir, inode.EDir:
+		return TypeDir
+	case inode.Sym, inode.ESym:
+		return TypeSymlink
+	case inode.Block, inode.EBlock, inode.Char, inode.EChar:
+		return TypeDevice
+	case inode.Fifo, inode.EFifo:
+		return TypeFifo
+	}
+	return TypeSocket
+}
+
+// Criteria for FS.Find. A file must match all set criteria. The zero value matches every file.
+type Query struct {
+	// A path.Match pattern matched against the file's name.
+	Name string
+	// A pattern matched against the file's path relative to the FS. Supports ** the same as FS.Glob.
+	Path string
+	// The allowed file types. 0 allows all types.
+	Types FileType
+	// The range of allowed sizes. A MaxSize of 0 means there's no maximum. Only regular files have a size, other files
+	// are treated as having a size of 0.
+	MinSize, MaxSize int64
+	// Only match empty regular files and directories.
+	Empty bool
+	// Only match files last modified at or after ModifiedAfter and before ModifiedBefore. Zero times are ignored.
+	ModifiedAfter, ModifiedBefore time.Time
+	// The allowed owners and groups. Empty allows all.
+	Uids, Gids []uint32
+	// PermAll requires all of it's permission bits to be set. PermAny requires at least one of it's bits to be set.
+	PermAll, PermAny fs.FileMode
+	// The range of allowed hard link counts. A MaxLinks of 0 means there's no maximum.
+	MinLinks, MaxLinks uint32
+}
+
+// Returns whether matching requires reading the file's inode, instead of only it's directory entry.
+func (q Query) needsInode() bool {
+	return q.MinSize != 0 || q.MaxSize != 0 || q.Empty || !q.ModifiedAfter.IsZero() || !q.ModifiedBefore.IsZero() ||
+		len(q.Uids) > 0 || len(q.Gids) > 0 || q.PermAll != 0 || q.PermAny != 0 || q.MinLinks != 0 || q.MaxLinks != 0
+}
+
+func (q Query) matchEntry(d *DirEntry, pathPattern, pathParts []string) bool {
+	if q.Types != 0 && q.Types&fileTypeOf(d.e.InodeType) == 0 {
+		return false
+	}
+	if q.Name != "" {
+		if match, _ := path.Match(q.Name, d.e.Name); !match {
+			return false
+		}
+	}
+	if pathPattern != nil && !pathmatch.MatchParts(pathPattern, pathParts, false) {
+		return false
+	}
+	return true
+}
+
+func (q Query) matchInode(r *Reader, b squashfslow.FileBase) (bool, error) {
+	var size int64
+	if b.Inode.Type == inode.Fil || b.Inode.Type == inode.EFil {
+		size = int64(b.Inode.Size())
+	}
+	if size < q.MinSize || (q.MaxSize != 0 && size > q.MaxSize) {
+		return false, nil
+	}
+	if q.Empty {
+		switch b.Inode.Type {
+		case inode.Fil, inode.EFil:
+			if size != 0 {
+				return false, nil
+			}
+		case inode.Dir:
+			// Empty directories have a size of 3.
+			if b.Inode.Data.(inode.Directory).Size > 3 {
+				return false, nil
+			}
+		case inode.EDir:
+			if b.Inode.Data.(inode.EDirectory).Size > 3 {
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+	mod := time.Unix(int64(b.Inode.ModTime), 0)
+	if (!q.ModifiedAfter.IsZero() && mod.Before(q.ModifiedAfter)) || (!q.ModifiedBefore.IsZero() && !mod.Before(q.ModifiedBefore)) {
+		return false, nil
+	}
+	perm := b.Inode.Mode().Perm()
+	if perm&q.PermAll.Perm() != q.PermAll.Perm() || (q.PermAny != 0 && perm&q.PermAny == 0) {
+		return false, nil
+	}
+	links := b.Inode.LinkCount()
+	if links < q.MinLinks || (q.MaxLinks != 0 && links > q.MaxLinks) {
+		return false, nil
+	}
+	if len(q.Uids) > 0 {
+		uid, err := b.Uid(&r.Low)
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(q.Uids, uid) {
+			return false, nil
+		}
+	}
+	if len(q.Gids) > 0 {
+		gid, err := b.Gid(&r.Low)
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(q.Gids, gid) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Called by FS.Find for each matching file. p is the file's path relative to the FS.
+// d only reads the file's inode if needed, or if it was already needed to check the Query.
+// Returning fs.SkipAll stops Find without an error. Returning fs.SkipDir skips the contents of the file if it's a directory.
+type FindFunc func(p string, d *DirEntry) error
+
+// Calls fn for each file below the FS that matches q, in the same order as fs.WalkDir. The FS's directory itself is not included.
+// Files are matched using their directory entry and inode, so no file data is read. Directories that can't contain
+// a match for q.Path aren't read.
+func (f FS) Find(q Query, fn FindFunc) error {
+	if q.Name != "" {
+		if _, err := path.Match(q.Name, ""); err != nil {
+			return err
+		}
+	}
+	if q.Path != "" {
+		if _, err := path.Match(q.Path, ""); err != nil {
+			return err
+		}
+	}
+	err := f.find(q, nil, fn)
+	if err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// Returns the paths of all files that match q. Same as Find.
+func (f FS) FindAll(q Query) (out []string, err error) {
+	err = f.Find(q, func(p string, _ *DirEntry) error {
+		out = append(out, p)
+		return nil
+	})
+	return
+}
+
+func (f FS) find(q Query, parts []string, fn FindFunc) error {
+	var pathPattern []string
+	if q.Path != "" {
+		pathPattern = strings.Split(q.Path, "/")
+	}
+	for _, e := range f.LowDir.Entries {
+		d := &DirEntry{r: f.r, e: e}
+		subParts := append(slices.Clip(parts), e.Name)
+		p := strings.Join(subParts, "/")
+		match := q.matchEntry(d, pathPattern, subParts)
+		if match && q.needsInode() {
+			b, err := d.base()
+			if err != nil {
+				return &fs.PathError{Op: "find", Path: p, Err: err}
+			}
+			match, err = q.matchInode(f.r, b)
+			if err != nil {
+				return &fs.PathError{Op: "find", Path: p, Err: err}
+			}
+		}
+		if match {
+			err := fn(p, d)
+			if err == fs.SkipDir {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if !d.IsDir() || (pathPattern != nil && !pathmatch.MatchParts(pathPattern, subParts, true)) {
+			continue
+		}
+		b, err := d.base()
+		if err != nil {
+			return &fs.PathError{Op: "find", Path: p, Err: err}
+		}
+		dir, err := b.ToDir(f.r.Low)
+		if err != nil {
+			return &fs.PathError{Op: "find", Path: p, Err: err}
+		}
+		err = f.r.FSFromDirectory(dir, f).find(q, subParts, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
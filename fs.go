@@ -4,7 +4,6 @@ import (
 	"io"
 	"io/fs"
 	"path"
-	"path/filepath"
 	"slices"
 	"strings"
 
@@ -31,62 +30,25 @@ func (r *Reader) FSFromDirectory(d squashfslow.Directory, parent FS) FS {
 
 // Glob returns the name of the files at the given pattern.
 // All paths are relative to the FS.
-// Uses filepath.Match to compare names.
-func (f *FS) Glob(pattern string) (out []string, err error) {
-	pattern = filepath.Clean(pattern)
-	if !fs.ValidPath(pattern) {
-		return nil, &fs.PathError{
-			Op:   "glob",
-			Path: pattern,
-			Err:  fs.ErrInvalid,
-		}
+// Uses path.Match to compare names. A ** component matches any number of directories, so "usr/**/*.so" matches
+// files ending in .so anywhere below usr.
+func (f FS) Glob(pattern string) (out []string, err error) {
+	// Makes sure the pattern is valid, even if nothing is compared against it.
+	_, err = path.Match(pattern, "")
+	if err != nil {
+		return nil, err
 	}
-	split := strings.Split(pattern, "/")
-	for i := range f.LowDir.Entries {
-		if match, _ := path.Match(split[0], f.LowDir.Entries[i].Name); match {
-			if len(split) == 1 {
-				out = append(out, f.LowDir.Entries[i].Name)
-				continue
-			}
-			sub, err := f.Sub(split[0])
-			if err != nil {
-				if pathErr, ok := err.(*fs.PathError); ok {
-					if pathErr.Err == fs.ErrNotExist {
-						continue
-					}
-					pathErr.Op = "glob"
-					pathErr.Path = pattern
-					return nil, pathErr
-				}
-				return nil, &fs.PathError{
-					Op:   "glob",
-					Path: pattern,
-					Err:  err,
-				}
-			}
-			subGlob, err := sub.(fs.GlobFS).Glob(strings.Join(split[1:], "/"))
-			if err != nil {
-				if pathErr, ok := err.(*fs.PathError); ok {
-					if pathErr.Err == fs.ErrNotExist {
-						continue
-					}
-					pathErr.Op = "glob"
-					pathErr.Path = pattern
-					return nil, pathErr
-				}
-				return nil, &fs.PathError{
-					Op:   "glob",
-					Path: pattern,
-					Err:  err,
-				}
-			}
-			for i := range subGlob {
-				subGlob[i] = f.LowDir.Name + "/" + subGlob[i]
-			}
-			out = append(out, subGlob...)
+	if !hasMeta(pattern) {
+		if _, err = f.Stat(pattern); err != nil {
+			return nil, nil
 		}
+		return []string{pattern}, nil
 	}
-	return
+	return f.FindAll(Query{Path: pattern})
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
 }
 
 // Opens the file at name. Returns a *File as an fs.File.
@@ -94,8 +56,8 @@ func (f FS) Open(name string) (fs.File, error) {
 	return f.OpenFile(name)
 }
 
+// Same as Open, but returns a *File.
 func (f FS) OpenFile(name string) (*File, error) {
-	name = filepath.Clean(name)
 	if !fs.ValidPath(name) {
 		return nil, &fs.PathError{
 			Op:   "open",
@@ -103,36 +65,42 @@ func (f FS) OpenFile(name string) (*File, error) {
 			Err:  fs.ErrInvalid,
 		}
 	}
+	out, err := f.open(name)
+	if err != nil {
+		return nil, &fs.PathError{
+			Op:   "open",
+			Path: name,
+			Err:  err,
+		}
+	}
+	return out, nil
+}
+
+// Opens the file at name without requiring it to be a valid fs path, so it may contain "..", such as a symlink's target.
+// Trying to go above the archive's root returns fs.ErrNotExist.
+func (f FS) open(name string) (*File, error) {
+	name = path.Clean(name)
 	if name == "." || name == "" {
 		return f.File(), nil
 	}
-	split := strings.Split(name, "/")
-	if split[0] == ".." {
+	first, rest, _ := strings.Cut(name, "/")
+	if first == ".." {
 		if f.parent == nil { // root directory
-			return nil, &fs.PathError{
-				Op:   "open",
-				Path: name,
-				Err:  fs.ErrNotExist,
-			}
-		} else {
-			return f.parent.OpenFile(strings.Join(split[1:], "/"))
+			return nil, fs.ErrNotExist
 		}
+		return f.parent.open(rest)
 	}
-	i, found := slices.BinarySearchFunc(f.LowDir.Entries, split[0], func(e directory.Entry, name string) int {
+	i, found := slices.BinarySearchFunc(f.LowDir.Entries, first, func(e directory.Entry, name string) int {
 		return strings.Compare(e.Name, name)
 	})
 	if !found {
-		return nil, &fs.PathError{
-			Op:   "open",
-			Path: name,
-			Err:  fs.ErrNotExist,
-		}
+		return nil, fs.ErrNotExist
 	}
 	b, err := f.r.Low.BaseFromEntry(f.LowDir.Entries[i])
 	if err != nil {
 		return nil, err
 	}
-	if len(split) == 1 {
+	if rest == "" {
 		return &File{
 			Low:    b,
 			r:      f.r,
@@ -140,23 +108,18 @@ func (f FS) OpenFile(name string) (*File, error) {
 		}, nil
 	}
 	if !b.IsDir() {
-		return nil, &fs.PathError{
-			Op:   "open",
-			Path: name,
-			Err:  fs.ErrNotExist,
-		}
+		return nil, fs.ErrNotExist
 	}
 	d, err := b.ToDir(f.r.Low)
 	if err != nil {
 		return nil, err
 	}
-	return f.r.FSFromDirectory(d, f).OpenFile(strings.Join(split[1:], "/"))
+	return f.r.FSFromDirectory(d, f).open(rest)
 }
 
 // Returns all DirEntry's for the directory at name.
 // If name is not a directory, returns an error.
 func (f FS) ReadDir(name string) ([]fs.DirEntry, error) {
-	name = filepath.Clean(name)
 	if !fs.ValidPath(name) {
 		return nil, &fs.PathError{
 			Op:   "readdir",
@@ -176,7 +139,6 @@ func (f FS) ReadDir(name string) ([]fs.DirEntry, error) {
 
 // Returns the contents of the file at name.
 func (f FS) ReadFile(name string) (out []byte, err error) {
-	name = filepath.Clean(name)
 	if !fs.ValidPath(name) {
 		return nil, &fs.PathError{
 			Op:   "readfile",
@@ -184,22 +146,23 @@ func (f FS) ReadFile(name string) (out []byte, err error) {
 			Err:  fs.ErrInvalid,
 		}
 	}
-	if name == "." || name == "" {
-		return nil, fs.ErrInvalid
-	}
-	fil, err := f.Open(name)
+	fil, err := f.OpenFile(name)
 	if err != nil {
 		return nil, err
 	}
-	if !fil.(*File).IsRegular() {
-		return nil, fs.ErrInvalid
+	defer fil.Close()
+	if fil.IsDir() || fil.IsSymlink() {
+		return nil, &fs.PathError{
+			Op:   "readfile",
+			Path: name,
+			Err:  fs.ErrInvalid,
+		}
 	}
 	return io.ReadAll(fil)
 }
 
 // Returns the fs.FileInfo for the file at name.
 func (f FS) Stat(name string) (fs.FileInfo, error) {
-	name = filepath.Clean(name)
 	if !fs.ValidPath(name) {
 		return nil, &fs.PathError{
 			Op:   "stat",
@@ -219,7 +182,6 @@ func (f FS) Stat(name string) (fs.FileInfo, error) {
 
 // Returns the FS at dir
 func (f FS) Sub(dir string) (fs.FS, error) {
-	dir = filepath.Clean(dir)
 	if !fs.ValidPath(dir) {
 		return nil, &fs.PathError{
 			Op:   "dir",
@@ -275,5 +237,5 @@ func (f FS) path() string {
 	if f.parent == nil {
 		return f.LowDir.Name
 	}
-	return filepath.Join(f.parent.path(), f.LowDir.Name)
+	return path.Join(f.parent.path(), f.LowDir.Name)
 }
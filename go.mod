@@ -8,4 +8,5 @@ require (
 	github.com/pierrec/lz4/v4 v4.1.22
 	github.com/rasky/go-lzo v0.0.0-20200203143853-96a758eda86e
 	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/sys v0.36.0
 )
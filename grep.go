@@ -0,0 +1,262 @@
+package squashfs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"regexp"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+const (
+	// Lines longer than this are searched in pieces.
+	grepMaxLine = 1024 * 1024
+	// When a line is searched in pieces, this much of the previous piece is searched again,
+	// so matches shorter than this are still found.
+	grepOverlap = 4096
+	// The amount of the start of a file checked for null bytes to decide if it's binary.
+	grepBinaryCheck = 8192
+)
+
+var errGrepBinary = errors.New("binary file")
+
+// Options for FS.Grep.
+type GrepOptions struct {
+	// The regular expression to search for. Ignored if Literal is set.
+	Pattern *regexp.Regexp
+	// Bytes to search for.
+	Literal []byte
+	// Only search files whose path matches the pattern. Supports ** the same as FS.Glob.
+	Glob string
+	// Skip files with a null byte near their start.
+	SkipBinary bool
+	// The number of lines before and after the matching line to include.
+	Context int
+	// The number of files searched at once. Defaults to runtime.NumCPU().
+	Routines int
+}
+
+// A single match found by FS.Grep.
+type GrepMatch struct {
+	Path   string
+	Offset int64 // The offset of the match in the file.
+	Length int   // The length of the match.
+	Line   int   // The line number of the match, starting at 1.
+	// The line containing the match, without it's newline. Lines longer than 1MiB are searched in pieces,
+	// so Text is only part of the line.
+	Text []byte
+	// The lines before and after Text, if GrepOptions.Context is set.
+	Before, After [][]byte
+	// Whether the file looks like binary data. Only possible if GrepOptions.SkipBinary isn't set.
+	Binary bool
+}
+
+// Called by FS.Grep. A file's matches are given in order once the whole file has been searched.
+// Calls are never concurrent. Returning an error stops the search. Returning fs.SkipAll stops the search without an error.
+type GrepFunc func(m GrepMatch) error
+
+// Searches the contents of every regular file below the FS. Files are searched concurrently and each file's data is
+// decompressed in parallel. Files are searched line by line, so matches are found even if they cross a block boundary,
+// but can't contain a newline.
+//
+// If a file can't be read, the rest of the files are still searched and the error is returned once done.
+func (f FS) Grep(op GrepOptions, fn GrepFunc) error {
+	if op.Pattern == nil && len(op.Literal) == 0 {
+		return errors.New("no pattern given")
+	}
+	if op.Routines <= 0 {
+		op.Routines = runtime.NumCPU()
+	}
+	type job struct {
+		path string
+		d    *DirEntry
+	}
+	jobs := make(chan job)
+	var (
+		wg      sync.WaitGroup
+		mut     sync.Mutex
+		errs    []error
+		stopErr error
+		stopped bool
+	)
+	for range op.Routines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				mut.Lock()
+				stop := stopped
+				mut.Unlock()
+				if stop {
+					continue
+				}
+				matches, err := f.grepFile(op, j.path, j.d)
+				mut.Lock()
+				if err != nil {
+					errs = append(errs, &fs.PathError{Op: "grep", Path: j.path, Err: err})
+				}
+				for _, m := range matches {
+					if stopped {
+						break
+					}
+					err = fn(m)
+					if err != nil {
+						stopped = true
+						stopErr = err
+					}
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	err := f.Find(Query{Path: op.Glob, Types: TypeRegular}, func(p string, d *DirEntry) error {
+		mut.Lock()
+		stop := stopped
+		mut.Unlock()
+		if stop {
+			return fs.SkipAll
+		}
+		jobs <- job{path: p, d: d}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if stopErr != nil && stopErr != fs.SkipAll {
+		return stopErr
+	}
+	return errors.Join(errs...)
+}
+
+func (f FS) grepFile(op GrepOptions, p string, d *DirEntry) ([]GrepMatch, error) {
+	b, err := d.base()
+	if err != nil {
+		return nil, err
+	}
+	full, err := b.GetFullReader(&f.r.Low)
+	if err != nil {
+		return nil, err
+	}
+	defer full.Close()
+	g := &grepper{op: op, path: p, line: 1}
+	_, err = full.WriteTo(g)
+	if errors.Is(err, errGrepBinary) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	g.finish()
+	return g.matches, nil
+}
+
+// Searches data written to it line by line.
+type grepper struct {
+	op      GrepOptions
+	path    string
+	matches []GrepMatch
+	pending []int // Indexes of matches that still need lines after them.
+	prev    [][]byte
+	buf     []byte // The current, incomplete, line.
+	bufOff  int64  // The file offset of buf[0].
+	line    int
+	checked int // The amount of the start of the file checked for binary data.
+	binary  bool
+}
+
+func (g *grepper) Write(p []byte) (int, error) {
+	if g.checked < grepBinaryCheck {
+		check := p[:min(len(p), grepBinaryCheck-g.checked)]
+		g.checked += len(check)
+		if bytes.IndexByte(check, 0) != -1 {
+			g.binary = true
+			if g.op.SkipBinary {
+				return 0, errGrepBinary
+			}
+		}
+	}
+	g.buf = append(g.buf, p...)
+	start := 0
+	for {
+		nl := bytes.IndexByte(g.buf[start:], '\n')
+		if nl == -1 {
+			break
+		}
+		g.searchLine(g.buf[start : start+nl])
+		start += nl + 1
+		g.bufOff += int64(nl + 1)
+	}
+	g.buf = append(g.buf[:0], g.buf[start:]...)
+	if len(g.buf) > grepMaxLine {
+		// Search most of the line now and drop it, keeping the end for matches that continue into the next write.
+		keep := len(g.buf) - grepOverlap
+		g.searchRange(g.buf, keep)
+		g.buf = append(g.buf[:0], g.buf[keep:]...)
+		g.bufOff += int64(keep)
+	}
+	return len(p), nil
+}
+
+func (g *grepper) finish() {
+	if len(g.buf) > 0 {
+		g.searchLine(g.buf)
+	}
+	for i := range g.matches {
+		g.matches[i].Binary = g.binary
+	}
+}
+
+// Searches a full line and adds it to the context of previous matches.
+func (g *grepper) searchLine(line []byte) {
+	for _, i := range g.pending {
+		g.matches[i].After = append(g.matches[i].After, bytes.Clone(line))
+	}
+	g.pending = slices.DeleteFunc(g.pending, func(i int) bool {
+		return len(g.matches[i].After) >= g.op.Context
+	})
+	g.searchRange(line, len(line))
+	if g.op.Context > 0 {
+		if len(g.prev) == g.op.Context {
+			g.prev = append(g.prev[:0], g.prev[1:]...)
+		}
+		g.prev = append(g.prev, bytes.Clone(line))
+	}
+	g.line++
+}
+
+// Adds matches in line that start before to.
+func (g *grepper) searchRange(line []byte, to int) {
+	var locs [][]int
+	if len(g.op.Literal) > 0 {
+		for off := 0; ; {
+			i := bytes.Index(line[off:], g.op.Literal)
+			if i == -1 {
+				break
+			}
+			locs = append(locs, []int{off + i, off + i + len(g.op.Literal)})
+			off += i + len(g.op.Literal)
+		}
+	} else {
+		locs = g.op.Pattern.FindAllIndex(line, -1)
+	}
+	for _, loc := range locs {
+		if loc[0] >= to {
+			continue
+		}
+		m := GrepMatch{
+			Path:   g.path,
+			Offset: g.bufOff + int64(loc[0]),
+			Length: loc[1] - loc[0],
+			Line:   g.line,
+			Text:   bytes.Clone(line),
+		}
+		if g.op.Context > 0 {
+			m.Before = slices.Clone(g.prev)
+			g.pending = append(g.pending, len(g.matches))
+		}
+		g.matches = append(g.matches, m)
+	}
+}
@@ -0,0 +1,378 @@
+// Package httpreader provides an io.ReaderAt that reads a remote file using HTTP range requests.
+// It's meant to allow opening squashfs archives on a web server without downloading the entire archive.
+package httpreader
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrChanged          = errors.New("remote file changed while reading")
+	ErrRangeUnsupported = errors.New("server does not support range requests")
+)
+
+type Options struct {
+	Client *http.Client // The client used for requests. Defaults to http.DefaultClient.
+	Header http.Header  // Extra headers added to each request, such as authorization.
+	// The size of the blocks requested and cached. Defaults to 64KiB.
+	BlockSize int64
+	// The maximum number of blocks kept in memory. Defaults to 256.
+	CacheBlocks int
+	// The number of blocks after a read to also request. Defaults to 4.
+	ReadAhead int
+	// The number of times a failed request is retried. Defaults to 3.
+	Retries int
+	// The delay before the first retry. The delay doubles for each retry. Defaults to 250ms.
+	RetryDelay time.Duration
+}
+
+// The default options.
+func DefaultOptions() *Options {
+	return &Options{
+		Client:      http.DefaultClient,
+		BlockSize:   64 * 1024,
+		CacheBlocks: 256,
+		ReadAhead:   4,
+		Retries:     3,
+		RetryDelay:  250 * time.Millisecond,
+	}
+}
+
+// Reader is an io.ReaderAt for a file on a HTTP server. Reads are split into blocks that are cached in memory.
+// Missing blocks that are next to each other are requested together.
+//
+// If the server provides an ETag or Last-Modified header, every request is checked against the values from the first request
+// and ErrChanged is returned if the file has changed.
+type Reader struct {
+	op           Options
+	url          string
+	etag         string
+	lastModified string
+	size         int64
+	mut          sync.Mutex
+	lru          *list.List
+	cache        map[int64]*list.Element
+	inflight     map[int64]*fetch
+}
+
+type cachedBlock struct {
+	idx int64
+	dat []byte
+}
+
+// A single range request that's in progress.
+type fetch struct {
+	done   chan struct{}
+	blocks map[int64][]byte
+	err    error
+}
+
+// Creates a new Reader for the file at url. A request is made to determine the file's size and to make sure
+// the server supports range requests. If op is nil, DefaultOptions is used.
+func New(url string, op *Options) (*Reader, error) {
+	def := DefaultOptions()
+	if op == nil {
+		op = def
+	}
+	out := &Reader{
+		op:       *op,
+		url:      url,
+		lru:      list.New(),
+		cache:    make(map[int64]*list.Element),
+		inflight: make(map[int64]*fetch),
+	}
+	if out.op.Client == nil {
+		out.op.Client = def.Client
+	}
+	if out.op.BlockSize <= 0 {
+		out.op.BlockSize = def.BlockSize
+	}
+	if out.op.CacheBlocks <= 0 {
+		out.op.CacheBlocks = def.CacheBlocks
+	}
+	if out.op.ReadAhead < 0 {
+		out.op.ReadAhead = 0
+	}
+	if out.op.Retries < 0 {
+		out.op.Retries = 0
+	}
+	if out.op.RetryDelay <= 0 {
+		out.op.RetryDelay = def.RetryDelay
+	}
+	var resp *http.Response
+	err := out.retry(func() (err error) {
+		resp, err = out.request(0, 0)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	_, _, out.size, err = parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+	out.etag = resp.Header.Get("ETag")
+	out.lastModified = resp.Header.Get("Last-Modified")
+	return out, nil
+}
+
+// The size of the remote file.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// The remote file's ETag. Empty if the server didn't provide one.
+func (r *Reader) ETag() string {
+	return r.etag
+}
+
+// The remote file's modification time. Zero if the server didn't provide it.
+func (r *Reader) LastModified() time.Time {
+	t, _ := http.ParseTime(r.lastModified)
+	return t
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), r.size)
+	first, last := off/r.op.BlockSize, (end-1)/r.op.BlockSize
+	blocks, err := r.blocks(first, last)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i, dat := range blocks {
+		blockStart := (first + int64(i)) * r.op.BlockSize
+		start := max(off-blockStart, 0)
+		n += copy(p[n:], dat[start:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Returns the blocks from first to last (inclusive), requesting any that aren't cached along with the read ahead blocks.
+func (r *Reader) blocks(first, last int64) ([][]byte, error) {
+	out := make([][]byte, last-first+1)
+	waits := make(map[int64]*fetch)
+	lastBlock := (r.size - 1) / r.op.BlockSize
+	end := min(last+int64(r.op.ReadAhead), lastBlock)
+	type run struct {
+		first, last int64
+		f           *fetch
+	}
+	var runs []run
+	var cur *fetch
+	r.mut.Lock()
+	for i := first; i <= end; i++ {
+		if el, has := r.cache[i]; has {
+			cur = nil
+			if i <= last {
+				r.lru.MoveToFront(el)
+				out[i-first] = el.Value.(cachedBlock).dat
+			}
+			continue
+		}
+		if f, has := r.inflight[i]; has {
+			cur = nil
+			if i <= last {
+				waits[i] = f
+			}
+			continue
+		}
+		// Read ahead only continues runs of required blocks to avoid extra requests.
+		if i > last && cur == nil {
+			break
+		}
+		if cur == nil {
+			cur = &fetch{
+				done:   make(chan struct{}),
+				blocks: make(map[int64][]byte),
+			}
+			runs = append(runs, run{first: i, f: cur})
+		}
+		runs[len(runs)-1].last = i
+		r.inflight[i] = cur
+		if i <= last {
+			waits[i] = cur
+		}
+	}
+	r.mut.Unlock()
+	for _, rn := range runs {
+		go r.fetchRun(rn.first, rn.last, rn.f)
+	}
+	for i, f := range waits {
+		<-f.done
+		if f.err != nil {
+			return nil, f.err
+		}
+		out[i-first] = f.blocks[i]
+	}
+	return out, nil
+}
+
+func (r *Reader) fetchRun(first, last int64, f *fetch) {
+	start := first * r.op.BlockSize
+	end := min((last+1)*r.op.BlockSize, r.size) - 1
+	var dat []byte
+	f.err = r.retry(func() error {
+		resp, err := r.request(start, end)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		dat = make([]byte, end-start+1)
+		_, err = io.ReadFull(resp.Body, dat)
+		return err
+	})
+	r.mut.Lock()
+	for i := first; i <= last; i++ {
+		delete(r.inflight, i)
+		if f.err != nil {
+			continue
+		}
+		blockStart := (i - first) * r.op.BlockSize
+		block := dat[blockStart:min(blockStart+r.op.BlockSize, int64(len(dat)))]
+		f.blocks[i] = block
+		r.cache[i] = r.lru.PushFront(cachedBlock{idx: i, dat: block})
+	}
+	for r.lru.Len() > r.op.CacheBlocks {
+		el := r.lru.Back()
+		delete(r.cache, el.Value.(cachedBlock).idx)
+		r.lru.Remove(el)
+	}
+	r.mut.Unlock()
+	close(f.done)
+}
+
+// Makes a request for the bytes from start to end (inclusive) and validates the response.
+func (r *Reader) request(start, end int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, permanent{err}
+	}
+	for k, v := range r.op.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	if r.etag != "" && !strings.HasPrefix(r.etag, "W/") {
+		req.Header.Set("If-Match", r.etag)
+	} else if r.lastModified != "" {
+		req.Header.Set("If-Unmodified-Since", r.lastModified)
+	}
+	resp, err := r.op.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*http.Response, error) {
+		resp.Body.Close()
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return fail(permanent{ErrChanged})
+	case resp.StatusCode == http.StatusOK:
+		return fail(permanent{ErrRangeUnsupported})
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fail(errors.New("server returned " + resp.Status))
+	case resp.StatusCode != http.StatusPartialContent:
+		return fail(permanent{errors.New("server returned " + resp.Status)})
+	}
+	if r.size != 0 {
+		if etag := resp.Header.Get("ETag"); r.etag != "" && etag != "" && etag != r.etag {
+			return fail(permanent{ErrChanged})
+		}
+		if lm := resp.Header.Get("Last-Modified"); r.lastModified != "" && lm != "" && lm != r.lastModified {
+			return fail(permanent{ErrChanged})
+		}
+		gotStart, gotEnd, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return fail(permanent{err})
+		}
+		if size != r.size {
+			return fail(permanent{ErrChanged})
+		}
+		if gotStart != start || gotEnd != end {
+			return fail(permanent{errors.New("server returned the wrong range")})
+		}
+	}
+	return resp, nil
+}
+
+// Errors that shouldn't be retried.
+type permanent struct {
+	err error
+}
+
+func (p permanent) Error() string {
+	return p.err.Error()
+}
+
+func (p permanent) Unwrap() error {
+	return p.err
+}
+
+func (r *Reader) retry(fn func() error) error {
+	delay := r.op.RetryDelay
+	var err error
+	for i := 0; ; i++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		var perm permanent
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if i >= r.op.Retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Parses a Content-Range header in the form "bytes start-end/size".
+func parseContentRange(header string) (start, end, size int64, err error) {
+	invalid := errors.New("invalid Content-Range: " + header)
+	rng, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	rng, sizeStr, found := strings.Cut(rng, "/")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	startStr, endStr, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+	start, err = strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return 0, 0, 0, invalid
+	}
+	end, err = strconv.ParseInt(endStr, 10, 64)
+	if err != nil {
+		return 0, 0, 0, invalid
+	}
+	size, err = strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, 0, 0, invalid
+	}
+	return start, end, size, nil
+}
@@ -0,0 +1,138 @@
+package httpreader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testServer(dat *[]byte, etag *string, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", *etag)
+		http.ServeContent(w, req, "image.sqfs", time.Time{}, bytes.NewReader(*dat))
+	}))
+}
+
+func TestReadAt(t *testing.T) {
+	dat := make([]byte, 1000*1000+123)
+	rand.New(rand.NewSource(42)).Read(dat)
+	etag := `"first"`
+	var requests atomic.Int32
+	srv := testServer(&dat, &etag, &requests)
+	defer srv.Close()
+	op := DefaultOptions()
+	op.BlockSize = 4096
+	op.CacheBlocks = 16
+	rdr, err := New(srv.URL, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rdr.Size() != int64(len(dat)) {
+		t.Fatal("size is", rdr.Size(), "should be", len(dat))
+	}
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for range 200 {
+				off := rng.Int63n(int64(len(dat)))
+				buf := make([]byte, rng.Intn(20000))
+				n, err := rdr.ReadAt(buf, off)
+				want := min(len(buf), len(dat)-int(off))
+				if n != want {
+					t.Error("read", n, "bytes instead of", want)
+					return
+				}
+				if n < len(buf) && err != io.EOF {
+					t.Error("short read without io.EOF:", err)
+					return
+				} else if n == len(buf) && err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(buf[:n], dat[off:off+int64(n)]) {
+					t.Error("data mismatch at offset", off)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// Sequential reads should be coalesced and read ahead.
+	before := requests.Load()
+	buf := make([]byte, 1024)
+	for off := int64(0); off < 40*4096; off += 1024 {
+		_, err = rdr.ReadAt(buf, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reqs := requests.Load() - before; reqs > 10 {
+		t.Fatal("sequential reads took", reqs, "requests")
+	}
+}
+
+func TestChanged(t *testing.T) {
+	dat := make([]byte, 100000)
+	etag := `"first"`
+	var requests atomic.Int32
+	srv := testServer(&dat, &etag, &requests)
+	defer srv.Close()
+	op := DefaultOptions()
+	op.BlockSize = 1024
+	op.ReadAhead = 0
+	rdr, err := New(srv.URL, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rdr.ReadAt(make([]byte, 10), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag = `"second"`
+	_, err = rdr.ReadAt(make([]byte, 10), 50000)
+	if !errors.Is(err, ErrChanged) {
+		t.Fatal("expected ErrChanged, got", err)
+	}
+}
+
+func TestRangeUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(make([]byte, 1000))
+	}))
+	defer srv.Close()
+	_, err := New(srv.URL, nil)
+	if !errors.Is(err, ErrRangeUnsupported) {
+		t.Fatal("expected ErrRangeUnsupported, got", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	dat := make([]byte, 10000)
+	var fails atomic.Int32
+	fails.Store(2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fails.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, req, "image.sqfs", time.Time{}, bytes.NewReader(dat))
+	}))
+	defer srv.Close()
+	op := DefaultOptions()
+	op.RetryDelay = time.Millisecond
+	_, err := New(srv.URL, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,45 @@
+package fileattr
+
+import (
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// Sets the owner and permissions of an extracted file. Symlinks' permissions can't be set, so only their owner is.
+// Errors are ignored since setting the owner usually requires root.
+func SetPerm(path string, i inode.Inode, uid, gid int) {
+	if i.Type == inode.Sym || i.Type == inode.ESym {
+		os.Lchown(path, uid, gid)
+		return
+	}
+	// Chown clears the setuid and setgid bits, so it's done first.
+	os.Chown(path, uid, gid)
+	os.Chmod(path, ChmodMode(i.Perm))
+}
+
+// Sets the modification time of an extracted file. Squashfs doesn't store access times, so they're set to the modification time.
+func SetModTime(path string, i inode.Inode) error {
+	mtime := time.Unix(int64(i.ModTime), 0)
+	if i.Type == inode.Sym || i.Type == inode.ESym {
+		return lchtimes(path, mtime)
+	}
+	return os.Chtimes(path, mtime, mtime)
+}
+
+// Converts squashfs permissions to the fs.FileMode expected by os.Chmod, which uses it's own bits for setuid, setgid, and sticky.
+func ChmodMode(perm uint16) fs.FileMode {
+	out := fs.FileMode(perm).Perm()
+	if perm&0o4000 != 0 {
+		out |= fs.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		out |= fs.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		out |= fs.ModeSticky
+	}
+	return out
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fileattr
+
+import "time"
+
+// Setting a symlink's times without following it is only supported on Unix systems. Elsewhere symlinks keep the time they're created.
+func lchtimes(path string, mtime time.Time) error {
+	return nil
+}
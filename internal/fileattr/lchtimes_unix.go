@@ -0,0 +1,20 @@
+//go:build unix
+
+package fileattr
+
+import (
+	"io/fs"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sets a symlink's access and modification times without following it.
+func lchtimes(path string, mtime time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(mtime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return &fs.PathError{Op: "lchtimes", Path: path, Err: err}
+	}
+	return nil
+}
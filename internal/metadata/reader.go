@@ -3,10 +3,16 @@ package metadata
 import (
 	"encoding/binary"
 	"io"
+	"slices"
 
 	"github.com/CalebQ42/squashfs/internal/decompress"
 )
 
+// Implemented by toreader.Reader to allow reading blocks without copying them.
+type nexter interface {
+	Next(n int) ([]byte, error)
+}
+
 type Reader struct {
 	r         io.Reader
 	d         decompress.Decompressor
@@ -30,12 +36,20 @@ func (r *Reader) advance() error {
 	}
 	size := binary.LittleEndian.Uint16(dat)
 	realSize := size &^ 0x8000
-	r.dat = make([]byte, realSize)
-	_, err = r.r.Read(r.dat)
+	if n, ok := r.r.(nexter); ok {
+		r.dat, err = n.Next(int(realSize))
+	} else {
+		r.dat = make([]byte, realSize)
+		_, err = r.r.Read(r.dat)
+	}
 	if err != nil {
 		return err
 	}
 	if size != realSize {
+		if _, ok := r.r.(nexter); ok {
+			// The block may reference a memory mapped archive, which can be closed while the Reader is still held.
+			r.dat = slices.Clone(r.dat)
+		}
 		return nil
 	}
 	r.dat, err = r.d.Decompress(r.dat)
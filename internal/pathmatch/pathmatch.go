@@ -0,0 +1,29 @@
+package pathmatch
+
+import "path"
+
+// Returns whether the path's components match the pattern's. A ** component matches zero or more components.
+// If prefix is true, instead returns whether the path could be extended to match, such as for a directory whose contents may match.
+func MatchParts(pattern, parts []string, prefix bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if prefix {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if MatchParts(pattern[1:], parts[i:], false) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return prefix
+		}
+		if match, _ := path.Match(pattern[0], parts[0]); !match {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0 && !prefix
+}
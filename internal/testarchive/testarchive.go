@@ -0,0 +1,69 @@
+package testarchive
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const (
+	URL  = "https://darkstorm.tech/files/LinuxPATest.sfs"
+	Name = "tensorflow.sqfs"
+	// A regular file in the archive.
+	FilePath = "usr/sbin/add-shell"
+)
+
+// Opens the archive used by the subpackages' tests from the testing directory at the module's root, downloading it if
+// it isn't there yet. The file is closed when the test finishes.
+func Open(t testing.TB) *os.File {
+	_, src, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(src), "..", "..", "testing")
+	fil, err := os.Open(filepath.Join(dir, Name))
+	if err != nil {
+		err = download(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fil, err = os.Open(filepath.Join(dir, Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { fil.Close() })
+	return fil
+}
+
+// Downloads the archive to dir. It's downloaded to a temporary file first so a failed download is never mistaken for the archive.
+func download(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	resp, err := http.DefaultClient.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("failed to download test archive: " + resp.Status)
+	}
+	_, err = io.Copy(tmp, resp.Body)
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, Name))
+}
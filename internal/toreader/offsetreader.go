@@ -17,3 +17,7 @@ func NewOffsetReader(r io.ReaderAt, off int64) *OffsetReader {
 func (r OffsetReader) ReadAt(p []byte, off int64) (n int, e error) {
 	return r.r.ReadAt(p, off+r.off)
 }
+
+func (r OffsetReader) Slice(off int64, n int) ([]byte, error) {
+	return ReadSlice(r.r, off+r.off, n)
+}
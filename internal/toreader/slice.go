@@ -0,0 +1,20 @@
+package toreader
+
+import "io"
+
+// An io.ReaderAt that can return it's data without copying it, such as a memory mapped file.
+type Slicer interface {
+	io.ReaderAt
+	// Returns the n bytes starting at off. The returned slice must not be modified.
+	Slice(off int64, n int) ([]byte, error)
+}
+
+// Returns the n bytes of r starting at off. If r is a Slicer, the data isn't copied and must not be modified.
+func ReadSlice(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	if s, ok := r.(Slicer); ok {
+		return s.Slice(off, n)
+	}
+	out := make([]byte, n)
+	red, err := r.ReadAt(out, off)
+	return out[:red], err
+}
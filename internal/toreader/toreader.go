@@ -19,3 +19,10 @@ func (r *Reader) Read(b []byte) (int, error) {
 	r.offset += int64(n)
 	return n, err
 }
+
+// Returns the next n bytes. If the underlying io.ReaderAt is a Slicer, the data isn't copied and must not be modified.
+func (r *Reader) Next(n int) ([]byte, error) {
+	out, err := ReadSlice(r.r, r.offset, n)
+	r.offset += int64(len(out))
+	return out, err
+}
@@ -0,0 +1,85 @@
+package squashfslow
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+
+	"github.com/CalebQ42/squashfs/internal/toreader"
+)
+
+// The result of CompareData.
+type DataComparison uint8
+
+const (
+	DataUnknown   DataComparison = iota // The data needs to be read to know if it's the same.
+	DataEqual                           // The files have the same contents.
+	DataDifferent                       // The files have different contents.
+)
+
+// Compares the contents of two regular files without decompressing their data blocks, if possible. a is from ra and b is from rb,
+// which can be the same Reader.
+//
+// Files of different sizes are different. Files from the same archive that use the same data blocks and fragment are the same.
+// If both archives use the same compression and block size, and the files' block size lists are the same, the compressed blocks
+// are compared directly, and then the ends of the files stored in fragments. Otherwise, returns DataUnknown.
+func CompareData(ra *Reader, a FileBase, rb *Reader, b FileBase) (DataComparison, error) {
+	if !a.IsRegular() || !b.IsRegular() {
+		return DataUnknown, errors.New("not a regular file")
+	}
+	aStart, aSizes, aFrag, aFragOff, aSize := a.dataLayout()
+	bStart, bSizes, bFrag, bFragOff, bSize := b.dataLayout()
+	if aSize != bSize {
+		return DataDifferent, nil
+	}
+	if aSize == 0 {
+		return DataEqual, nil
+	}
+	sameArchive := ra.stats == rb.stats
+	if sameArchive && aStart == bStart && slices.Equal(aSizes, bSizes) && aFrag == bFrag && aFragOff == bFragOff {
+		return DataEqual, nil
+	}
+	if ra.Superblock.CompType != rb.Superblock.CompType || ra.Superblock.BlockSize != rb.Superblock.BlockSize ||
+		!slices.Equal(aSizes, bSizes) || (aFrag == 0xFFFFFFFF) != (bFrag == 0xFFFFFFFF) {
+		return DataUnknown, nil
+	}
+	if !sameArchive || aStart != bStart {
+		for _, s := range aSizes {
+			realSize := int(s &^ (1 << 24))
+			aDat, err := toreader.ReadSlice(ra.r, int64(aStart), realSize)
+			if err != nil {
+				return DataUnknown, err
+			}
+			bDat, err := toreader.ReadSlice(rb.r, int64(bStart), realSize)
+			if err != nil {
+				return DataUnknown, err
+			}
+			if !bytes.Equal(aDat, bDat) {
+				// Compressed data can differ even if the uncompressed data doesn't.
+				return DataUnknown, nil
+			}
+			aStart += uint64(realSize)
+			bStart += uint64(realSize)
+		}
+	}
+	if aFrag == 0xFFFFFFFF || (sameArchive && aFrag == bFrag && aFragOff == bFragOff) {
+		return DataEqual, nil
+	}
+	// The fragments are already decompressed, so they can be compared directly.
+	tail := aSize % uint64(ra.Superblock.BlockSize)
+	aDat, err := ra.fragBlock(aFrag)
+	if err != nil {
+		return DataUnknown, err
+	}
+	bDat, err := rb.fragBlock(bFrag)
+	if err != nil {
+		return DataUnknown, err
+	}
+	if uint64(aFragOff)+tail > uint64(len(aDat)) || uint64(bFragOff)+tail > uint64(len(bDat)) {
+		return DataUnknown, errors.New("fragment offset out of bounds")
+	}
+	if bytes.Equal(aDat[aFragOff:uint64(aFragOff)+tail], bDat[bFragOff:uint64(bFragOff)+tail]) {
+		return DataEqual, nil
+	}
+	return DataDifferent, nil
+}
@@ -4,9 +4,12 @@ import (
 	"errors"
 	"io"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/CalebQ42/squashfs/internal/decompress"
+	"github.com/CalebQ42/squashfs/internal/toreader"
 )
 
 type FullReader struct {
@@ -47,8 +50,7 @@ func (f *FullReader) Close() error {
 
 func (f *FullReader) AddFragData(blockStart uint64, blockSize uint32, offset uint32) error {
 	realSize := blockSize &^ (1 << 24)
-	dat := make([]byte, realSize)
-	_, err := f.rdr.ReadAt(dat, int64(blockStart))
+	dat, err := toreader.ReadSlice(f.rdr, int64(blockStart), int(realSize))
 	if err != nil {
 		return err
 	}
@@ -58,12 +60,16 @@ func (f *FullReader) AddFragData(blockStart uint64, blockSize uint32, offset uin
 			return err
 		}
 	}
-	f.fragDat = make([]byte, f.fileSize%uint64(f.blockSize))
-	copy(f.fragDat, dat[offset:])
-	dat = nil
+	f.SetFragBlock(dat, offset)
 	return nil
 }
 
+// Sets the file's fragment data from it's already decompressed fragment block. offset is the data's offset within the block.
+func (f *FullReader) SetFragBlock(block []byte, offset uint32) {
+	f.fragDat = make([]byte, f.fileSize%uint64(f.blockSize))
+	copy(f.fragDat, block[offset:])
+}
+
 func (f *FullReader) SetDispatcherPool(dispatcher chan struct{}, pool *sync.Pool) {
 	f.dispatcher = dispatcher
 	f.pool = pool
@@ -78,7 +84,8 @@ func (f FullReader) BlockNum() uint32 {
 	return uint32(out)
 }
 
-// Returns the data block at the given index
+// Returns the data block at the given index.
+// If the underlying reader is memory mapped, uncompressed blocks reference the mapping directly and must not be modified.
 func (f FullReader) Block(i uint32) ([]byte, error) {
 	if i == uint32(len(f.sizes)) && f.fragDat != nil {
 		return f.fragDat, nil
@@ -93,8 +100,7 @@ func (f FullReader) Block(i uint32) ([]byte, error) {
 		}
 		return make([]byte, f.blockSize), nil
 	}
-	dat := make([]byte, realSize)
-	_, err := f.rdr.ReadAt(dat, int64(f.blockOffsets[i]))
+	dat, err := toreader.ReadSlice(f.rdr, int64(f.blockOffsets[i]), int(realSize))
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +110,20 @@ func (f FullReader) Block(i uint32) ([]byte, error) {
 	return dat, err
 }
 
+// Same as Block, but uncompressed blocks are copied if they reference the underlying reader's memory, so the block can
+// be kept after the archive is closed.
+func (f FullReader) ownedBlock(i uint32) ([]byte, error) {
+	dat, err := f.Block(i)
+	if err != nil || i >= uint32(len(f.sizes)) {
+		return dat, err
+	}
+	realSize := f.sizes[i] &^ (1 << 24)
+	if _, ok := f.rdr.(toreader.Slicer); ok && realSize != 0 && realSize != f.sizes[i] {
+		dat = slices.Clone(dat)
+	}
+	return dat, nil
+}
+
 func (f FullReader) blockFromPool(i uint32) *BlockResults {
 	out := f.pool.Get().(*BlockResults)
 	out.idx = i
@@ -123,9 +143,9 @@ func (f FullReader) blockFromPool(i uint32) *BlockResults {
 			return out
 		}
 		out.block = make([]byte, f.blockSize)
+		return out
 	}
-	out.block = make([]byte, realSize)
-	_, out.err = f.rdr.ReadAt(out.block, int64(f.blockOffsets[i]))
+	out.block, out.err = toreader.ReadSlice(f.rdr, int64(f.blockOffsets[i]), int(realSize))
 	if out.err != nil {
 		return out
 	}
@@ -155,7 +175,8 @@ func (f FullReader) WriteTo(w io.Writer) (wrote int64, err error) {
 			},
 		}
 	}
-	open := true
+	// Set once an error occurs so the remaining blocks aren't read.
+	var closed atomic.Bool
 	resChan := make(chan *BlockResults, len(f.dispatcher))
 	var results map[uint32]*BlockResults
 	if _, is := w.(io.WriterAt); !is {
@@ -165,7 +186,7 @@ func (f FullReader) WriteTo(w io.Writer) (wrote int64, err error) {
 		go func(idx uint32) {
 			<-f.dispatcher
 			defer func() { f.dispatcher <- struct{}{} }()
-			if !open {
+			if closed.Load() {
 				resChan <- f.pool.Get().(*BlockResults)
 				return
 			}
@@ -174,55 +195,44 @@ func (f FullReader) WriteTo(w io.Writer) (wrote int64, err error) {
 	}
 	out := int64(0)
 	errOut := make([]error, 0)
-	for i := uint32(0); i < f.BlockNum(); {
+	// i is the next block to write. Blocks that arrive early are held in results.
+	var i uint32
+	for range f.BlockNum() {
 		res := <-resChan
 		defer f.pool.Put(res)
 		if res.err != nil {
-			open = false
+			closed.Store(true)
 			errOut = append(errOut, res.err)
 		}
 		if len(errOut) > 0 {
-			i++
 			continue
 		}
 		if wa, is := w.(io.WriterAt); is {
 			_, err := wa.WriteAt(res.block, int64(res.idx)*int64(f.blockSize))
 			if err != nil {
+				closed.Store(true)
 				errOut = append(errOut, err)
 			} else {
 				out = max(out, int64(res.idx)*int64(f.blockSize)+int64(len(res.block)))
 			}
-			i++
 			continue
 		}
-		var err error
-		if res.idx == i {
-			_, err = w.Write(res.block)
+		results[res.idx] = res
+		for len(errOut) == 0 {
+			res, has := results[i]
+			if !has {
+				break
+			}
+			// res is returned to the pool by the defer above.
+			delete(results, i)
+			i++
+			_, err := w.Write(res.block)
 			if err != nil {
+				closed.Store(true)
 				errOut = append(errOut, err)
 			} else {
 				out = max(out, int64(res.idx)*int64(f.blockSize)+int64(len(res.block)))
 			}
-			i++
-		} else {
-			results[res.idx] = res
-		}
-		var has bool
-		for {
-			res, has = results[i]
-			if has {
-				_, err = w.Write(res.block)
-				if err != nil {
-					errOut = append(errOut, err)
-				} else {
-					out = max(out, int64(res.idx)*int64(f.blockSize)+int64(len(res.block)))
-				}
-				i++
-				delete(results, i)
-				f.pool.Put(res)
-			} else {
-				break
-			}
 		}
 	}
 	if len(errOut) > 0 {
@@ -1,16 +1,24 @@
 package data
 
-import "io"
+import (
+	"errors"
+	"io"
+)
 
 type Reader struct {
 	f         *FullReader
 	curBlock  []byte
 	nextIdx   uint32
 	curOffset uint32
+	pos       int64
 }
 
 func NewReader(f *FullReader) (Reader, error) {
-	dat, err := f.Block(0)
+	if f.BlockNum() == 0 {
+		// Empty file.
+		return Reader{f: f}, nil
+	}
+	dat, err := f.ownedBlock(0)
 	if err != nil {
 		return Reader{}, err
 	}
@@ -33,7 +41,7 @@ func (d *Reader) advanceBlock() error {
 		return io.EOF
 	}
 	var err error
-	d.curBlock, err = d.f.Block(d.nextIdx)
+	d.curBlock, err = d.f.ownedBlock(d.nextIdx)
 	if err != nil {
 		return err
 	}
@@ -50,6 +58,7 @@ func (d *Reader) Read(buf []byte) (int, error) {
 		if int(d.curOffset) >= len(d.curBlock) {
 			err = d.advanceBlock()
 			if err != nil {
+				d.pos += int64(totRed)
 				return totRed, err
 			}
 		}
@@ -58,5 +67,42 @@ func (d *Reader) Read(buf []byte) (int, error) {
 		totRed += toRead
 		d.curOffset += uint32(toRead)
 	}
+	d.pos += int64(totRed)
 	return totRed, nil
 }
+
+// Sets the offset of the next Read. Only the block containing the new offset is read.
+// Seeking past the end of the file is allowed, but Read will return io.EOF.
+func (d *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += int64(d.f.fileSize)
+	default:
+		return d.pos, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return d.pos, errors.New("negative position")
+	}
+	if offset >= int64(d.f.fileSize) {
+		d.curBlock = nil
+		d.nextIdx = d.f.BlockNum()
+		d.curOffset = 0
+		d.pos = offset
+		return offset, nil
+	}
+	idx := uint32(offset / int64(d.f.blockSize))
+	if d.curBlock == nil || idx != d.nextIdx-1 {
+		dat, err := d.f.ownedBlock(idx)
+		if err != nil {
+			return d.pos, err
+		}
+		d.curBlock = dat
+		d.nextIdx = idx + 1
+	}
+	d.curOffset = uint32(offset % int64(d.f.blockSize))
+	d.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,66 @@
+package squashfslow
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/CalebQ42/squashfs/internal/decompress"
+)
+
+// Decompresses blocks of data. The returned slice may be the same as the given slice.
+// A Reader uses a single Decompressor for all reads, so it must be safe for concurrent use.
+// The given slice may be from a read-only memory mapping, so it must not be modified.
+type Decompressor interface {
+	Decompress([]byte) ([]byte, error)
+}
+
+// Creates a new Decompressor. Called once for each Reader that needs it.
+type DecompressorFactory func() (Decompressor, error)
+
+var (
+	decompMut     sync.RWMutex
+	decompressors = map[uint16]DecompressorFactory{
+		ZlibCompression: func() (Decompressor, error) {
+			return decompress.NewZlib(), nil
+		},
+		LZMACompression: func() (Decompressor, error) {
+			return decompress.NewLzma()
+		},
+		LZOCompression: func() (Decompressor, error) {
+			return decompress.NewLzo()
+		},
+		XZCompression: func() (Decompressor, error) {
+			return decompress.NewXz(), nil
+		},
+		LZ4Compression: func() (Decompressor, error) {
+			return decompress.NewLz4(), nil
+		},
+		ZSTDCompression: func() (Decompressor, error) {
+			return decompress.NewZstd(), nil
+		},
+	}
+)
+
+// Registers the factory used to create a Decompressor for the given compression id.
+// Replaces any previously registered factory, including the built-in decompressors.
+// Registering a nil factory removes support for the compression id.
+func RegisterDecompressor(id uint16, factory DecompressorFactory) {
+	decompMut.Lock()
+	defer decompMut.Unlock()
+	if factory == nil {
+		delete(decompressors, id)
+		return
+	}
+	decompressors[id] = factory
+}
+
+func newDecompressor(id uint16) (Decompressor, error) {
+	decompMut.RLock()
+	factory, has := decompressors[id]
+	decompMut.RUnlock()
+	if !has {
+		return nil, errors.New("unsupported compression type " + strconv.Itoa(int(id)) + ". possible corrupted archive")
+	}
+	return factory()
+}
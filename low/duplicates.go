@@ -0,0 +1,205 @@
+package squashfslow
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// A group of regular files with the same contents.
+type DuplicateGroup struct {
+	// The paths of the files in the group. Only one path is given for hard linked files.
+	Paths []string
+	// The uncompressed size of each file.
+	Size uint64
+	// The bytes taken by one copy of the data. This is the size of the data blocks plus the uncompressed size of the fragment tail,
+	// since the compressed size of a tail can't be known.
+	DiskSize uint64
+	// The number of separate copies of the data stored in the archive.
+	Copies int
+	// The sha256 hash of the contents. Only set for groups found by hashing.
+	Hash []byte
+}
+
+// The results of Reader.Duplicates.
+type DuplicateReport struct {
+	// Groups of files that share the same data blocks and fragment in the archive, such as when mksquashfs deduplicates files.
+	Deduplicated []DuplicateGroup
+	// Groups of files with identical contents that are stored more then once in the archive.
+	// Only populated if hashing is enabled.
+	Identical []DuplicateGroup
+	// Bytes saved by files sharing data.
+	BytesSaved uint64
+	// Bytes that could be saved if identical files were deduplicated.
+	BytesSavable uint64
+}
+
+type dataKey struct {
+	blockStart uint64
+	fragIndex  uint32
+	fragOffset uint32
+	size       uint64
+	sizes      string
+}
+
+// Finds regular files that share data in the archive. If hash is true, the contents of files with matching sizes are hashed
+// to find identical data that is stored multiple times. Hashing requires reading and decompressing the files' data.
+// Empty files are ignored.
+func (r Reader) Duplicates(hash bool) (*DuplicateReport, error) {
+	var keys []dataKey
+	groups := make(map[dataKey]*DuplicateGroup)
+	reps := make(map[dataKey]FileBase)
+	seen := make(map[uint32]bool)
+	err := r.Walk(func(p string, b FileBase) error {
+		if !b.IsRegular() || seen[b.Inode.Num] {
+			return nil
+		}
+		seen[b.Inode.Num] = true
+		blockStart, sizes, fragIndex, fragOffset, fileSize := b.dataLayout()
+		if fileSize == 0 {
+			return nil
+		}
+		key := dataKey{
+			blockStart: blockStart,
+			fragIndex:  fragIndex,
+			fragOffset: fragOffset,
+			size:       fileSize,
+			sizes:      string(uint32Bytes(sizes)),
+		}
+		if g, has := groups[key]; has {
+			g.Paths = append(g.Paths, p)
+			return nil
+		}
+		g := &DuplicateGroup{
+			Paths:  []string{p},
+			Size:   fileSize,
+			Copies: 1,
+		}
+		for _, s := range sizes {
+			g.DiskSize += uint64(s &^ (1 << 24))
+		}
+		if fragIndex != 0xFFFFFFFF {
+			g.DiskSize += fileSize % uint64(r.Superblock.BlockSize)
+		}
+		groups[key] = g
+		reps[key] = b
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &DuplicateReport{}
+	for _, k := range keys {
+		g := groups[k]
+		if len(g.Paths) > 1 {
+			out.Deduplicated = append(out.Deduplicated, *g)
+			out.BytesSaved += uint64(len(g.Paths)-1) * g.DiskSize
+		}
+	}
+	if !hash {
+		return out, nil
+	}
+	// Only data with the same size as other data can be identical.
+	bySize := make(map[uint64][]dataKey)
+	for _, k := range keys {
+		bySize[k.size] = append(bySize[k.size], k)
+	}
+	var toHash []dataKey
+	for _, k := range keys {
+		if len(bySize[k.size]) > 1 {
+			toHash = append(toHash, k)
+		}
+	}
+	hashes, err := r.hashData(toHash, reps)
+	if err != nil {
+		return nil, err
+	}
+	type contentKey struct {
+		size uint64
+		hash [sha256.Size]byte
+	}
+	var contentOrder []contentKey
+	identical := make(map[contentKey][]dataKey)
+	for _, k := range toHash {
+		ck := contentKey{size: k.size, hash: hashes[k]}
+		if _, has := identical[ck]; !has {
+			contentOrder = append(contentOrder, ck)
+		}
+		identical[ck] = append(identical[ck], k)
+	}
+	for _, ck := range contentOrder {
+		copies := identical[ck]
+		if len(copies) < 2 {
+			continue
+		}
+		g := DuplicateGroup{
+			Size:     ck.size,
+			DiskSize: groups[copies[0]].DiskSize,
+			Copies:   len(copies),
+			Hash:     slices.Clone(ck.hash[:]),
+		}
+		for _, k := range copies {
+			g.Paths = append(g.Paths, groups[k].Paths...)
+			g.DiskSize = min(g.DiskSize, groups[k].DiskSize)
+		}
+		out.Identical = append(out.Identical, g)
+		out.BytesSavable += uint64(len(copies)-1) * g.DiskSize
+	}
+	return out, nil
+}
+
+// Hashes the data of the given files concurrently.
+func (r Reader) hashData(keys []dataKey, reps map[dataKey]FileBase) (map[dataKey][sha256.Size]byte, error) {
+	out := make(map[dataKey][sha256.Size]byte, len(keys))
+	var mut sync.Mutex
+	var errs []error
+	work := make(chan dataKey)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range work {
+				b := reps[k]
+				full, err := b.GetFullReader(&r)
+				if err != nil {
+					mut.Lock()
+					errs = append(errs, err)
+					mut.Unlock()
+					continue
+				}
+				h := sha256.New()
+				_, err = full.WriteTo(h)
+				full.Close()
+				mut.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					out[k] = [sha256.Size]byte(h.Sum(nil))
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	for _, k := range keys {
+		work <- k
+	}
+	close(work)
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errors.Join(errors.New("failed to hash file data"), errors.Join(errs...))
+	}
+	return out, nil
+}
+
+func uint32Bytes(in []uint32) []byte {
+	out := make([]byte, 0, len(in)*4)
+	for _, v := range in {
+		out = binary.LittleEndian.AppendUint32(out, v)
+	}
+	return out
+}
@@ -69,7 +69,7 @@ func (b FileBase) ToDir(r Reader) (Directory, error) {
 	if err != nil {
 		return Directory{}, err
 	}
-	entries, err := directory.ReadDirectory(&dirRdr, size)
+	entries, err := r.readDirectory(&dirRdr, size)
 	if err != nil {
 		return Directory{}, err
 	}
@@ -83,37 +83,30 @@ func (b FileBase) IsRegular() bool {
 	return b.Inode.Type == inode.Fil || b.Inode.Type == inode.EFil
 }
 
+// Returns where a regular file's data is located.
+func (b FileBase) dataLayout() (blockStart uint64, sizes []uint32, fragIndex uint32, fragOffset uint32, fileSize uint64) {
+	if b.Inode.Type == inode.Fil {
+		f := b.Inode.Data.(inode.File)
+		return uint64(f.BlockStart), f.BlockSizes, f.FragInd, f.FragOffset, uint64(f.Size)
+	}
+	f := b.Inode.Data.(inode.EFile)
+	return f.BlockStart, f.BlockSizes, f.FragInd, f.FragOffset, f.Size
+}
+
 // Returns a regular file's readers. They are linked, so the data.Reader calls to the data.FullReader.
 // Aka: closing the FullReader breaks the Reader
 func (b FileBase) GetRegFileReaders(r Reader) (data.Reader, data.FullReader, error) {
 	if !b.IsRegular() {
 		return data.Reader{}, data.FullReader{}, errors.New("not a regular file")
 	}
-	var blockStart uint64
-	var fragIndex uint32
-	var fragOffset uint32
-	var sizes []uint32
-	var fileSize uint64
-	if b.Inode.Type == inode.Fil {
-		blockStart = uint64(b.Inode.Data.(inode.File).BlockStart)
-		fragIndex = b.Inode.Data.(inode.File).FragInd
-		fragOffset = b.Inode.Data.(inode.File).FragOffset
-		sizes = b.Inode.Data.(inode.File).BlockSizes
-		fileSize = uint64(b.Inode.Data.(inode.File).Size)
-	} else {
-		blockStart = b.Inode.Data.(inode.EFile).BlockStart
-		fragIndex = b.Inode.Data.(inode.EFile).FragInd
-		fragOffset = b.Inode.Data.(inode.EFile).FragOffset
-		sizes = b.Inode.Data.(inode.EFile).BlockSizes
-		fileSize = b.Inode.Data.(inode.EFile).Size
-	}
-	outFull := data.NewFullReader(r.r, r.d, r.Superblock.BlockSize, fileSize, blockStart, sizes)
+	blockStart, sizes, fragIndex, fragOffset, fileSize := b.dataLayout()
+	outFull := data.NewFullReader(r.r, r.dataD, r.Superblock.BlockSize, fileSize, blockStart, sizes)
 	if fragIndex != 0xFFFFFFFF {
-		ent, err := r.fragEntry(fragIndex)
+		frag, err := r.fragBlock(fragIndex)
 		if err != nil {
 			return data.Reader{}, data.FullReader{}, err
 		}
-		outFull.AddFragData(ent.Start, ent.Size, fragOffset)
+		outFull.SetFragBlock(frag, fragOffset)
 	}
 	outRdr, err := data.NewReader(&outFull)
 	if err != nil {
@@ -126,31 +119,39 @@ func (b FileBase) GetFullReader(r *Reader) (data.FullReader, error) {
 	if !b.IsRegular() {
 		return data.FullReader{}, errors.New("not a regular file")
 	}
-	var blockStart uint64
-	var fragIndex uint32
-	var fragOffset uint32
-	var sizes []uint32
-	var fileSize uint64
-	if b.Inode.Type == inode.Fil {
-		blockStart = uint64(b.Inode.Data.(inode.File).BlockStart)
-		fragIndex = b.Inode.Data.(inode.File).FragInd
-		fragOffset = b.Inode.Data.(inode.File).FragOffset
-		sizes = b.Inode.Data.(inode.File).BlockSizes
-		fileSize = uint64(b.Inode.Data.(inode.File).Size)
-	} else {
-		blockStart = b.Inode.Data.(inode.EFile).BlockStart
-		fragIndex = b.Inode.Data.(inode.EFile).FragInd
-		fragOffset = b.Inode.Data.(inode.EFile).FragOffset
-		sizes = b.Inode.Data.(inode.EFile).BlockSizes
-		fileSize = b.Inode.Data.(inode.EFile).Size
-	}
-	outFull := data.NewFullReader(r.r, r.d, r.Superblock.BlockSize, fileSize, blockStart, sizes)
+	blockStart, sizes, fragIndex, fragOffset, fileSize := b.dataLayout()
+	outFull := data.NewFullReader(r.r, r.dataD, r.Superblock.BlockSize, fileSize, blockStart, sizes)
 	if fragIndex != 0xFFFFFFFF {
-		ent, err := r.fragEntry(fragIndex)
+		frag, err := r.fragBlock(fragIndex)
 		if err != nil {
 			return data.FullReader{}, err
 		}
-		outFull.AddFragData(ent.Start, ent.Size, fragOffset)
+		outFull.SetFragBlock(frag, fragOffset)
 	}
 	return outFull, nil
 }
+
+// Returns the regions of the archive holding a regular file's data. The file's data blocks are given as a single DataRegion,
+// followed by a FragmentRegion if the end of the file is stored in a fragment. Paths is not set.
+func (b FileBase) DataRegions(r *Reader) ([]Region, error) {
+	if !b.IsRegular() {
+		return nil, errors.New("not a regular file")
+	}
+	blockStart, sizes, fragIndex, _, _ := b.dataLayout()
+	var out []Region
+	end := blockStart
+	for _, s := range sizes {
+		end += uint64(s &^ (1 << 24))
+	}
+	if end > blockStart {
+		out = append(out, Region{Start: blockStart, End: end, Type: DataRegion})
+	}
+	if fragIndex != 0xFFFFFFFF {
+		ent, err := r.fragEntry(fragIndex)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Region{Start: ent.Start, End: ent.Start + uint64(ent.Size&^(1<<24)), Type: FragmentRegion, Index: fragIndex})
+	}
+	return out, nil
+}
@@ -1,7 +1,26 @@
 package squashfslow
 
+import "github.com/CalebQ42/squashfs/internal/toreader"
+
 type fragEntry struct {
 	Start uint64
 	Size  uint32
 	_     uint32
 }
+
+// Reads and decompresses the fragment block at the given index.
+func (r Reader) fragBlock(i uint32) ([]byte, error) {
+	ent, err := r.fragEntry(i)
+	if err != nil {
+		return nil, err
+	}
+	realSize := ent.Size &^ (1 << 24)
+	dat, err := toreader.ReadSlice(r.r, int64(ent.Start), int(realSize))
+	if err != nil {
+		return nil, err
+	}
+	if ent.Size == realSize {
+		return r.fragD.Decompress(dat)
+	}
+	return dat, nil
+}
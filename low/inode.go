@@ -17,12 +17,12 @@ func (r Reader) InodeFromRef(ref InodeRef) (inode.Inode, error) {
 	if err != nil {
 		return inode.Inode{}, err
 	}
-	return inode.Read(&rdr, r.Superblock.BlockSize)
+	return r.readInode(&rdr)
 }
 
 func (r Reader) InodeFromEntry(e directory.Entry) (inode.Inode, error) {
 	rdr := metadata.NewReader(toreader.NewReader(r.r, int64(r.Superblock.InodeTableStart)+int64(e.BlockStart)), r.d)
 	defer rdr.Close()
 	rdr.Read(make([]byte, e.Offset))
-	return inode.Read(&rdr, r.Superblock.BlockSize)
+	return r.readInode(&rdr)
 }
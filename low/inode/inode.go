@@ -25,6 +25,9 @@ const (
 	ESock
 )
 
+// The xattr index of inodes without xattrs.
+const NoXattr = 0xFFFFFFFF
+
 type Header struct {
 	Type    uint16
 	Perm    uint16
@@ -105,6 +108,9 @@ func (i Inode) Mode() (out fs.FileMode) {
 
 func (i Inode) LinkCount() uint32 {
 	switch i.Data.(type) {
+	case File:
+		// Basic files are only used if there's a single link.
+		return 1
 	case EFile:
 		return i.Data.(EFile).LinkCount
 	case Directory:
@@ -128,6 +134,25 @@ func (i Inode) LinkCount() uint32 {
 	}
 }
 
+// Returns the inode's index in the xattr table. Returns NoXattr if the inode doesn't have any xattrs.
+// Only extended inodes can have xattrs.
+func (i Inode) XattrIndex() uint32 {
+	switch i.Data.(type) {
+	case EFile:
+		return i.Data.(EFile).XattrInd
+	case EDirectory:
+		return i.Data.(EDirectory).XattrInd
+	case ESymlink:
+		return i.Data.(ESymlink).XattrInd
+	case EDevice:
+		return i.Data.(EDevice).XattrInd
+	case EIPC:
+		return i.Data.(EIPC).XattrInd
+	default:
+		return NoXattr
+	}
+}
+
 func (i Inode) Size() uint64 {
 	switch i.Data.(type) {
 	case File:
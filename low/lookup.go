@@ -0,0 +1,169 @@
+package squashfslow
+
+import (
+	"errors"
+	"path"
+	"sync"
+
+	"github.com/CalebQ42/squashfs/low/directory"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+var (
+	ErrorNoParent      = errors.New("root directory does not have a parent")
+	ErrorInodeNotFound = errors.New("inode number not found in archive")
+)
+
+// An index of every inode in the archive, built by walking the directory tree.
+// Used when the archive isn't exportable, and to find the parent of non-directory inodes.
+type inodeIndex struct {
+	once    sync.Once
+	err     error
+	entries map[uint32]indexEntry
+}
+
+type indexEntry struct {
+	ref    InodeRef
+	parent uint32
+	name   string
+}
+
+func entryRef(e directory.Entry) InodeRef {
+	return uint64(e.BlockStart)<<16 | uint64(e.Offset)
+}
+
+// Populates the inode index. Only the first path found for hard linked inodes is kept.
+func (r Reader) buildIndex() {
+	r.index.entries = make(map[uint32]indexEntry, r.Superblock.InodeCount)
+	r.index.entries[r.Root.Inode.Num] = indexEntry{ref: r.Superblock.RootInodeRef}
+	dirs := []Directory{r.Root}
+	var d Directory
+	var sub FileBase
+	var err error
+	for len(dirs) > 0 {
+		d = dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		for _, e := range d.Entries {
+			if _, has := r.index.entries[e.Num]; has {
+				continue
+			}
+			r.index.entries[e.Num] = indexEntry{
+				ref:    entryRef(e),
+				parent: d.Inode.Num,
+				name:   e.Name,
+			}
+			if e.InodeType != inode.Dir && e.InodeType != inode.EDir {
+				continue
+			}
+			sub, err = r.BaseFromEntry(e)
+			if err != nil {
+				r.index.err = errors.Join(errors.New("failed to read inode for "+e.Name), err)
+				return
+			}
+			subDir, err := sub.ToDir(r)
+			if err != nil {
+				r.index.err = errors.Join(errors.New("failed to read directory "+e.Name), err)
+				return
+			}
+			dirs = append(dirs, subDir)
+		}
+	}
+}
+
+func (r Reader) indexEntry(num uint32) (indexEntry, error) {
+	r.index.once.Do(r.buildIndex)
+	if r.index.err != nil {
+		return indexEntry{}, r.index.err
+	}
+	ent, has := r.index.entries[num]
+	if !has {
+		return indexEntry{}, ErrorInodeNotFound
+	}
+	return ent, nil
+}
+
+// Returns the inode reference for the given inode number.
+// Uses the export table if present, otherwise the archive is scanned once to build an index.
+func (r Reader) InodeRefFromNum(num uint32) (InodeRef, error) {
+	if num == 0 || num > r.Superblock.InodeCount {
+		return 0, ErrorInodeNotFound
+	}
+	if r.Superblock.Exportable() {
+		return r.inodeRef(num - 1) // Inode table is 1 indexed
+	}
+	ent, err := r.indexEntry(num)
+	if err != nil {
+		return 0, err
+	}
+	return ent.ref, nil
+}
+
+// Returns the inode number of the directory containing the given inode.
+// Directories use their inode's parent number, all other inodes require scanning the archive.
+// If the inode is hard linked, only one of it's parents is returned.
+func (r Reader) ParentNum(num uint32) (uint32, error) {
+	if num == r.Root.Inode.Num {
+		return 0, ErrorNoParent
+	}
+	in, err := r.Inode(num)
+	if err != nil {
+		return 0, err
+	}
+	switch in.Type {
+	case inode.Dir:
+		return in.Data.(inode.Directory).ParentNum, nil
+	case inode.EDir:
+		return in.Data.(inode.EDirectory).ParentNum, nil
+	}
+	ent, err := r.indexEntry(num)
+	if err != nil {
+		return 0, err
+	}
+	return ent.parent, nil
+}
+
+// Returns the path, relative to the root directory, of the given inode.
+// The root directory returns ".".
+func (r Reader) PathOf(num uint32) (string, error) {
+	if num == r.Root.Inode.Num {
+		return ".", nil
+	}
+	if !r.Superblock.Exportable() {
+		ent, err := r.indexEntry(num)
+		if err != nil {
+			return "", err
+		}
+		parPath, err := r.PathOf(ent.parent)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(parPath, ent.name), nil
+	}
+	parent, err := r.ParentNum(num)
+	if err != nil {
+		return "", err
+	}
+	parIn, err := r.Inode(parent)
+	if err != nil {
+		return "", err
+	}
+	parDir, err := r.BaseFromInode(parIn, "").ToDir(r)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	for _, e := range parDir.Entries {
+		if e.Num == num {
+			name = e.Name
+			break
+		}
+	}
+	if name == "" {
+		return "", ErrorInodeNotFound
+	}
+	parPath, err := r.PathOf(parent)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(parPath, name), nil
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"log/slog"
 
-	"github.com/CalebQ42/squashfs/internal/decompress"
 	"github.com/CalebQ42/squashfs/internal/toreader"
 	"github.com/CalebQ42/squashfs/low/inode"
 )
@@ -31,15 +31,59 @@ type Reader struct {
 	Root        Directory
 	Superblock  superblock
 	r           io.ReaderAt
-	d           decompress.Decompressor
+	d           Decompressor // Used for metadata.
+	dataD       Decompressor
+	fragD       Decompressor
 	fragTable   *Table[fragEntry]
 	idTable     *Table[uint32]
 	exportTable *Table[InodeRef]
+	xattrTable  *Table[xattrId]
+	xattrStart  uint64
+	index       *inodeIndex
+	trace       *traceRecorder
+	prefetch    *prefetcher
+	stats       *readerStats
+	logger      *slog.Logger
 }
 
-func NewReader(r io.ReaderAt) (rdr Reader, err error) {
-	rdr.r = r
-	err = binary.Read(toreader.NewReader(r, 0), binary.LittleEndian, &rdr.Superblock)
+// Options used when creating a Reader.
+type ReaderOptions struct {
+	// Used instead of the Decompressor registered for the archive's compression type.
+	Decompressor Decompressor
+	// Record the reads made by the Reader. The recording is available from Reader.Trace.
+	RecordTrace bool
+	// A Trace recorded from a previous Reader. The trace's reads are made in the background
+	// so the data is in memory before it's requested. Ignored if the trace is from a different archive.
+	Prefetch *Trace
+	// The maximum amount of prefetched data kept in memory. Data that's been read is only removed when room is needed
+	// for more data, so up to this amount of memory is used for the life of the Reader. Defaults to 64MiB.
+	PrefetchLimit uint64
+	// The number of goroutines used to prefetch data. Defaults to 4.
+	PrefetchRoutines int
+	// Receives the operations done by the Reader.
+	Tracer Tracer
+	// Receives events that don't cause an error, such as prefetching stopping early. Also used by extraction
+	// if ExtractionOptions.Logger isn't set. Defaults to discarding all events.
+	Logger *slog.Logger
+}
+
+func NewReader(r io.ReaderAt) (Reader, error) {
+	return NewReaderWithOptions(r, nil)
+}
+
+// Creates a new Reader using the given options. op may be nil.
+func NewReaderWithOptions(r io.ReaderAt, op *ReaderOptions) (rdr Reader, err error) {
+	rdr.stats = &readerStats{}
+	rdr.logger = slog.New(slog.DiscardHandler)
+	if op != nil {
+		rdr.stats.tracer = op.Tracer
+		if op.Logger != nil {
+			rdr.logger = op.Logger
+		}
+	}
+	rdr.r = statReader{r: r, stats: rdr.stats}
+	rdr.index = &inodeIndex{}
+	err = binary.Read(toreader.NewReader(rdr.r, 0), binary.LittleEndian, &rdr.Superblock)
 	if err != nil {
 		return rdr, errors.Join(errors.New("failed to read superblock"), err)
 	}
@@ -52,28 +96,36 @@ func NewReader(r io.ReaderAt) (rdr Reader, err error) {
 	if !rdr.Superblock.ValidVersion() {
 		return rdr, ErrorVersion
 	}
-	switch rdr.Superblock.CompType {
-	case ZlibCompression:
-		rdr.d = decompress.NewZlib()
-	case LZMACompression:
-		rdr.d, err = decompress.NewLzma()
-		if err != nil {
-			return rdr, err
+	if op != nil && op.Prefetch != nil && !op.Prefetch.Matches(rdr) {
+		rdr.logger.Info("prefetch trace is from a different archive, ignoring it",
+			"op", "prefetch", "trace_size", op.Prefetch.ArchiveSize, "archive_size", rdr.Superblock.Size)
+	} else if op != nil && op.Prefetch != nil {
+		limit, routines := op.PrefetchLimit, op.PrefetchRoutines
+		if limit == 0 {
+			limit = 64 * 1024 * 1024
+		}
+		if routines <= 0 {
+			routines = 4
 		}
-	case LZOCompression:
-		rdr.d, err = decompress.NewLzo()
+		rdr.prefetch = newPrefetcher(rdr.r, op.Prefetch, limit, routines, rdr.stats, rdr.logger)
+		rdr.r = rdr.prefetch
+	}
+	if op != nil && op.RecordTrace {
+		rdr.trace = newTraceRecorder(rdr.r)
+		rdr.r = rdr.trace
+	}
+	var d Decompressor
+	if op != nil && op.Decompressor != nil {
+		d = op.Decompressor
+	} else {
+		d, err = newDecompressor(rdr.Superblock.CompType)
 		if err != nil {
 			return rdr, err
 		}
-	case XZCompression:
-		rdr.d = decompress.NewXz()
-	case LZ4Compression:
-		rdr.d = decompress.NewLz4()
-	case ZSTDCompression:
-		rdr.d = decompress.NewZstd()
-	default:
-		return rdr, errors.New("invalid compression type. possible corrupted archive")
 	}
+	rdr.d = newStatDecompressor(d, MetadataSpan, rdr.Superblock.CompType, rdr.stats)
+	rdr.dataD = newStatDecompressor(d, DataSpan, rdr.Superblock.CompType, rdr.stats)
+	rdr.fragD = newStatDecompressor(d, FragmentSpan, rdr.Superblock.CompType, rdr.stats)
 	rdr.Root, err = rdr.directoryFromRef(rdr.Superblock.RootInodeRef, "")
 	if err != nil {
 		return rdr, errors.Join(errors.New("failed to read root directory"), err)
@@ -81,6 +133,10 @@ func NewReader(r io.ReaderAt) (rdr Reader, err error) {
 	rdr.fragTable = NewTable(&rdr, rdr.Superblock.FragTableStart, rdr.Superblock.FragCount, readFrag)
 	rdr.idTable = NewTable(&rdr, rdr.Superblock.IdTableStart, uint32(rdr.Superblock.IdCount), readId)
 	rdr.exportTable = NewTable(&rdr, rdr.Superblock.ExportTableStart, rdr.Superblock.InodeCount, readRef)
+	err = rdr.initXattrs()
+	if err != nil {
+		return rdr, errors.Join(errors.New("failed to read xattr table header"), err)
+	}
 	return
 }
 
@@ -129,10 +185,26 @@ func (r *Reader) inodeRef(i uint32) (InodeRef, error) {
 	return r.exportTable.Get(i)
 }
 
+// Get the inode with the given inode number.
+// Uses the export table if available, otherwise the archive is scanned for the inode.
 func (r Reader) Inode(i uint32) (inode.Inode, error) {
-	ref, err := r.inodeRef(i - 1) // Inode table is 1 indexed
+	ref, err := r.InodeRefFromNum(i)
 	if err != nil {
 		return inode.Inode{}, err
 	}
 	return r.InodeFromRef(ref)
 }
+
+// Stops prefetching started by ReaderOptions.Prefetch and waits for it's reads to finish, so the io.ReaderAt can be
+// safely closed afterwards. The io.ReaderAt itself isn't closed. Reads made after Close go directly to the io.ReaderAt.
+func (r Reader) Close() error {
+	if r.prefetch != nil {
+		r.prefetch.stop()
+	}
+	return nil
+}
+
+// Returns the logger given to ReaderOptions.Logger. If none was given, the returned logger discards all events.
+func (r Reader) Logger() *slog.Logger {
+	return r.logger
+}
@@ -1,12 +1,15 @@
 package squashfslow
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 )
 
@@ -148,3 +151,276 @@ func extractToDir(rdr Reader, b FileBase, folder string) error {
 	}
 	return nil
 }
+
+func TestRegionIndex(t *testing.T) {
+	tmpDir := "../testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := rdr.RegionIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var end uint64
+	for _, r := range idx.All() {
+		if r.Start != end {
+			t.Fatal("region", r.Type, "starts at", r.Start, "but previous region ended at", end)
+		}
+		end = r.End
+	}
+	if end != rdr.Superblock.Size {
+		t.Fatal("regions end at", end, "but archive is", rdr.Superblock.Size)
+	}
+	b, err := rdr.Root.Open(rdr, singleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockStart, sizes, _, _, _ := b.dataLayout()
+	if len(sizes) == 0 {
+		return
+	}
+	owners := idx.Owners(blockStart, blockStart+1)
+	if !slices.Contains(owners, singleFile) {
+		t.Fatal(singleFile, "not in owners of it's first block:", owners)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tmpDir := "../testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+	rdr, err := NewReaderWithOptions(fil, &ReaderOptions{RecordTrace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rdr.Root.Open(rdr, singleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := b.GetFullReader(&rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	_, err = full.WriteTo(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = rdr.Trace().WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(trace.Events, rdr.Trace().Events) {
+		t.Fatal("trace changed when saved and read")
+	}
+	rdr, err = NewReaderWithOptions(fil, &ReaderOptions{Prefetch: trace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = rdr.Root.Open(rdr, singleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err = b.GetFullReader(&rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	_, err = full.WriteTo(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatal("prefetched data doesn't match")
+	}
+}
+
+// Counts the reads that reach the underlying reader.
+type countingReader struct {
+	r     io.ReaderAt
+	mut   sync.Mutex
+	reads int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.mut.Lock()
+	c.reads++
+	c.mut.Unlock()
+	return c.r.ReadAt(p, off)
+}
+
+func TestPrefetcher(t *testing.T) {
+	dat := make([]byte, 1000)
+	for i := range dat {
+		dat[i] = byte(i)
+	}
+	trace := &Trace{Events: []TraceEvent{
+		{Type: TraceRead, Offset: 0, Size: 100},
+		{Type: TraceRead, Offset: 100, Size: 100},
+		{Type: TraceRead, Offset: 50, Size: 300}, // Overlaps both ranges before it.
+	}}
+	under := &countingReader{r: bytes.NewReader(dat)}
+	p := newPrefetcher(under, trace, 1000, 2, &readerStats{}, nil)
+	// The ranges depend on the order the reads finish, but always cover the first 350 bytes once.
+	for {
+		p.mut.Lock()
+		n := 0
+		for _, r := range p.ranges {
+			n += len(r.dat)
+		}
+		p.mut.Unlock()
+		if n == 350 {
+			break
+		}
+		<-p.consumed
+	}
+	under.mut.Lock()
+	under.reads = 0
+	under.mut.Unlock()
+	for _, rd := range [][2]int{{0, 100}, {150, 20}, {90, 30}, {10, 300}, {0, 350}} {
+		buf := make([]byte, rd[1])
+		if !p.serve(buf, uint64(rd[0])) {
+			t.Fatal("read at", rd[0], "of", rd[1], "bytes wasn't prefetched")
+		}
+		if !bytes.Equal(buf, dat[rd[0]:rd[0]+rd[1]]) {
+			t.Fatal("read at", rd[0], "of", rd[1], "bytes is wrong")
+		}
+	}
+	if p.serve(make([]byte, 10), 345) {
+		t.Fatal("read past the prefetched data was served")
+	}
+	if under.reads != 0 {
+		t.Fatal("prefetched reads went to the underlying reader")
+	}
+	p.mut.Lock()
+	for _, r := range p.ranges {
+		if r.used != len(r.dat) {
+			t.Fatal("range at", r.off, "isn't fully used after being read")
+		}
+	}
+	p.mut.Unlock()
+	p = newPrefetcher(under, &Trace{Events: []TraceEvent{{Type: TraceRead, Size: 100}}}, 1000, 1, &readerStats{}, nil)
+	p.stop()
+	if p.serve(make([]byte, 10), 0) {
+		t.Fatal("read was served after stopping")
+	}
+	// Reading the same bytes repeatedly doesn't count as reading the whole range.
+	rng := prefetchRange{dat: make([]byte, 100)}
+	for range 20 {
+		rng.markRead(0, 10)
+	}
+	if rng.used != 10 {
+		t.Fatal("repeated reads counted as", rng.used, "bytes")
+	}
+	if rng.markRead(50, 100) || rng.markRead(5, 40) || !rng.markRead(40, 50) || len(rng.read) != 1 {
+		t.Fatal("range isn't complete after every byte is read")
+	}
+}
+
+type testTracer struct {
+	mut   sync.Mutex
+	kinds map[SpanKind]int
+}
+
+func (t *testTracer) StartSpan(s Span) func(Span, error) {
+	return func(s Span, err error) {
+		t.mut.Lock()
+		defer t.mut.Unlock()
+		t.kinds[s.Kind]++
+	}
+}
+
+func TestStats(t *testing.T) {
+	tmpDir := "../testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+	tracer := &testTracer{kinds: make(map[SpanKind]int)}
+	rdr, err := NewReaderWithOptions(fil, &ReaderOptions{Tracer: tracer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rdr.Root.Open(rdr, singleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := b.GetFullReader(&rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = full.WriteTo(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := rdr.Stats()
+	if stats.Reads == 0 || stats.BytesRead == 0 {
+		t.Fatal("reads weren't counted")
+	}
+	if stats.MetadataBlocks == 0 || stats.Inodes == 0 || stats.Directories == 0 {
+		t.Fatal("metadata wasn't counted")
+	}
+	if stats.CompType != rdr.Superblock.CompType {
+		t.Fatal("stats are for compression type", stats.CompType, "instead of", rdr.Superblock.CompType)
+	}
+	tracer.mut.Lock()
+	defer tracer.mut.Unlock()
+	if uint64(tracer.kinds[ReadSpan]) != stats.Reads || uint64(tracer.kinds[InodeSpan]) != stats.Inodes {
+		t.Fatal("tracer spans don't match stats")
+	}
+}
+
+func TestCompareData(t *testing.T) {
+	tmpDir := "../testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rdr.Root.Open(rdr, singleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Xattrs(&rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp, err := CompareData(&rdr, b, &rdr, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp != DataEqual {
+		t.Fatal("file isn't equal to itself")
+	}
+	// A different Reader of the same archive has to compare the data blocks.
+	cmp, err = CompareData(&rdr, b, &other, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp != DataEqual {
+		t.Fatal("file isn't equal to itself from another Reader")
+	}
+}
@@ -0,0 +1,252 @@
+package squashfslow
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"slices"
+
+	"github.com/CalebQ42/squashfs/internal/toreader"
+)
+
+type RegionType uint8
+
+// The types of regions an archive is made of.
+const (
+	SuperblockRegion = RegionType(iota)
+	CompressionOptionsRegion
+	DataRegion
+	FragmentRegion
+	InodeTableRegion
+	DirectoryTableRegion
+	FragmentTableRegion
+	ExportTableRegion
+	IdTableRegion
+	XattrTableRegion
+)
+
+func (t RegionType) String() string {
+	switch t {
+	case SuperblockRegion:
+		return "superblock"
+	case CompressionOptionsRegion:
+		return "compression options"
+	case DataRegion:
+		return "data"
+	case FragmentRegion:
+		return "fragment"
+	case InodeTableRegion:
+		return "inode table"
+	case DirectoryTableRegion:
+		return "directory table"
+	case FragmentTableRegion:
+		return "fragment table"
+	case ExportTableRegion:
+		return "export table"
+	case IdTableRegion:
+		return "id table"
+	case XattrTableRegion:
+		return "xattr table"
+	}
+	return "unknown"
+}
+
+// A contiguous range of bytes in the archive.
+type Region struct {
+	Start uint64 // Offset of the first byte of the region.
+	End   uint64 // Offset just after the last byte of the region.
+	Type  RegionType
+	// For DataRegion, the index of the block within it's file(s).
+	// For FragmentRegion, the fragment's index in the fragment table.
+	Index uint32
+	// For DataRegion and FragmentRegion, the paths of all files with data in the region.
+	// Hard links and deduplicated files cause multiple paths.
+	Paths []string
+}
+
+// An index of every region of an archive, allowing archive offsets to be mapped to the files that use them.
+type RegionIndex struct {
+	regions []Region
+}
+
+// Builds an index of every region in the archive, including the data blocks and fragments of every file.
+// Requires reading every inode in the archive.
+func (r Reader) RegionIndex() (*RegionIndex, error) {
+	out := &RegionIndex{}
+	dataBlocks := make(map[uint64]int)
+	fragOwners := make(map[uint32][]string)
+	err := r.Walk(func(p string, b FileBase) error {
+		if !b.IsRegular() {
+			return nil
+		}
+		blockStart, sizes, fragIndex, _, _ := b.dataLayout()
+		for i, s := range sizes {
+			realSize := uint64(s &^ (1 << 24))
+			if realSize == 0 {
+				continue
+			}
+			if ind, has := dataBlocks[blockStart]; has {
+				out.regions[ind].Paths = append(out.regions[ind].Paths, p)
+			} else {
+				dataBlocks[blockStart] = len(out.regions)
+				out.regions = append(out.regions, Region{
+					Start: blockStart,
+					End:   blockStart + realSize,
+					Type:  DataRegion,
+					Index: uint32(i),
+					Paths: []string{p},
+				})
+			}
+			blockStart += realSize
+		}
+		if fragIndex != 0xFFFFFFFF {
+			fragOwners[fragIndex] = append(fragOwners[fragIndex], p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ent fragEntry
+	for i := range r.Superblock.FragCount {
+		ent, err = r.fragEntry(i)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read fragment entry"), err)
+		}
+		out.regions = append(out.regions, Region{
+			Start: ent.Start,
+			End:   ent.Start + uint64(ent.Size&^(1<<24)),
+			Type:  FragmentRegion,
+			Index: i,
+			Paths: fragOwners[i],
+		})
+	}
+	meta, err := r.metadataRegions()
+	if err != nil {
+		return nil, err
+	}
+	out.regions = append(out.regions, meta...)
+	slices.SortFunc(out.regions, func(a, b Region) int {
+		if a.Start < b.Start {
+			return -1
+		} else if a.Start > b.Start {
+			return 1
+		}
+		return 0
+	})
+	return out, nil
+}
+
+// Returns the regions of the superblock, compression options, and the inode, directory, fragment, export, id, and xattr tables.
+func (r Reader) metadataRegions() ([]Region, error) {
+	out := []Region{{Start: 0, End: 96, Type: SuperblockRegion}}
+	if r.Superblock.CompressionOptions() {
+		var size uint16
+		err := binary.Read(toreader.NewReader(r.r, 96), binary.LittleEndian, &size)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read compression options"), err)
+		}
+		out = append(out, Region{Start: 96, End: 98 + uint64(size&^0x8000), Type: CompressionOptionsRegion})
+	}
+	// Lookup tables are stored as their metadata blocks followed by the table's index.
+	lookup := func(start uint64, items uint64, itemSize uint64, typ RegionType) error {
+		if start == 0xFFFFFFFFFFFFFFFF || items == 0 {
+			return nil
+		}
+		var firstBlock uint64
+		err := binary.Read(toreader.NewReader(r.r, int64(start)), binary.LittleEndian, &firstBlock)
+		if err != nil {
+			return errors.Join(errors.New("failed to read "+typ.String()+" index"), err)
+		}
+		blocks := (items*itemSize + 8191) / 8192
+		out = append(out, Region{Start: firstBlock, End: start + blocks*8, Type: typ})
+		return nil
+	}
+	err := lookup(r.Superblock.FragTableStart, uint64(r.Superblock.FragCount), 16, FragmentTableRegion)
+	if err != nil {
+		return nil, err
+	}
+	if r.Superblock.Exportable() {
+		err = lookup(r.Superblock.ExportTableStart, uint64(r.Superblock.InodeCount), 8, ExportTableRegion)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = lookup(r.Superblock.IdTableStart, uint64(r.Superblock.IdCount), 4, IdTableRegion)
+	if err != nil {
+		return nil, err
+	}
+	if r.Superblock.XattrTableStart != 0xFFFFFFFFFFFFFFFF {
+		var hdr struct {
+			KvStart uint64
+			Count   uint32
+			_       uint32
+		}
+		err = binary.Read(toreader.NewReader(r.r, int64(r.Superblock.XattrTableStart)), binary.LittleEndian, &hdr)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read xattr table header"), err)
+		}
+		blocks := (uint64(hdr.Count)*16 + 8191) / 8192
+		out = append(out, Region{Start: hdr.KvStart, End: r.Superblock.XattrTableStart + 16 + blocks*8, Type: XattrTableRegion})
+	}
+	// The directory table ends where the first table after it begins.
+	dirEnd := r.Superblock.Size
+	for _, t := range out {
+		if t.Start > r.Superblock.DirTableStart {
+			dirEnd = min(dirEnd, t.Start)
+		}
+	}
+	out = append(out,
+		Region{Start: r.Superblock.InodeTableStart, End: r.Superblock.DirTableStart, Type: InodeTableRegion},
+		Region{Start: r.Superblock.DirTableStart, End: dirEnd, Type: DirectoryTableRegion},
+	)
+	return out, nil
+}
+
+// Returns all regions that overlap the range [start, end).
+func (i *RegionIndex) Regions(start, end uint64) []Region {
+	// Regions are sorted and don't overlap, so the first candidate is the last region starting at or before start.
+	ind, found := slices.BinarySearchFunc(i.regions, start, func(r Region, off uint64) int {
+		if r.Start < off {
+			return -1
+		} else if r.Start > off {
+			return 1
+		}
+		return 0
+	})
+	if !found && ind > 0 {
+		ind--
+	}
+	var out []Region
+	for ; ind < len(i.regions) && i.regions[ind].Start < end; ind++ {
+		if i.regions[ind].End > start {
+			out = append(out, i.regions[ind])
+		}
+	}
+	return out
+}
+
+// Returns the region containing the given offset. Returns fs.ErrNotExist if the offset isn't in any known region,
+// such as padding at the end of the archive.
+func (i *RegionIndex) At(offset uint64) (Region, error) {
+	reg := i.Regions(offset, offset+1)
+	if len(reg) == 0 {
+		return Region{}, fs.ErrNotExist
+	}
+	return reg[0], nil
+}
+
+// Returns the paths of every file with data in the range [start, end), sorted and without duplicates.
+func (i *RegionIndex) Owners(start, end uint64) []string {
+	var out []string
+	for _, r := range i.Regions(start, end) {
+		out = append(out, r.Paths...)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// Returns every region in the index, sorted by offset.
+func (i *RegionIndex) All() []Region {
+	return i.regions
+}
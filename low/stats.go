@@ -0,0 +1,229 @@
+package squashfslow
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/CalebQ42/squashfs/internal/metadata"
+	"github.com/CalebQ42/squashfs/internal/toreader"
+	"github.com/CalebQ42/squashfs/low/directory"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// Counters of the work done by a Reader. Returned by Reader.Stats.
+type Stats struct {
+	Reads     uint64 // Calls to the underlying io.ReaderAt.
+	BytesRead uint64 // Bytes read from the underlying io.ReaderAt.
+
+	// The archive's compression type, such as ZSTDCompression. The decompression counters and times are all for this
+	// compressor, so Stats from archives with different compressors shouldn't be combined.
+	CompType uint16
+
+	MetadataBlocks  uint64 // Metadata blocks decompressed.
+	DataBlocks      uint64 // Data blocks decompressed.
+	FragmentBlocks  uint64 // Fragment blocks decompressed.
+	MetadataTime    time.Duration
+	DataTime        time.Duration
+	FragmentTime    time.Duration
+	DecompressBytes uint64 // Compressed bytes given to the decompressor.
+
+	Inodes      uint64 // Inodes decoded.
+	Directories uint64 // Directories decoded.
+
+	// Lookups in the fragment, id, export, and xattr id tables that were served from the part of the table already loaded,
+	// and that required reading it. These are the only tables the Reader caches. Metadata and data blocks aren't cached,
+	// so reading one again is counted again in Reads and the decompression counters instead of as a hit.
+	TableHits, TableMisses uint64
+	// Reads that were served from data prefetched with ReaderOptions.Prefetch, and reads that weren't.
+	PrefetchHits, PrefetchMisses uint64
+}
+
+// The total time spent decompressing.
+func (s Stats) DecompressTime() time.Duration {
+	return s.MetadataTime + s.DataTime + s.FragmentTime
+}
+
+type SpanKind uint8
+
+const (
+	ReadSpan      = SpanKind(iota) // A read from the underlying io.ReaderAt.
+	MetadataSpan                   // Decompressing a metadata block.
+	DataSpan                       // Decompressing a data block.
+	FragmentSpan                   // Decompressing a fragment block.
+	InodeSpan                      // Decoding an inode.
+	DirectorySpan                  // Decoding a directory's entries.
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case ReadSpan:
+		return "read"
+	case MetadataSpan:
+		return "decompress metadata"
+	case DataSpan:
+		return "decompress data"
+	case FragmentSpan:
+		return "decompress fragment"
+	case InodeSpan:
+		return "inode"
+	case DirectorySpan:
+		return "directory"
+	}
+	return "unknown"
+}
+
+// Describes an operation given to a Tracer.
+type Span struct {
+	Kind   SpanKind
+	Offset uint64 // For ReadSpan, the offset of the read.
+	Size   uint64 // For ReadSpan the size of the read, for decompression the size of the compressed data.
+	// For decompression, the archive's compression type.
+	CompType uint16
+	Inode    uint32 // For InodeSpan, the number of the decoded inode. Only known once the span ends.
+}
+
+// Receives the operations done by a Reader, such as to integrate with a tracing system. Set with ReaderOptions.Tracer.
+// Must be safe for concurrent use.
+type Tracer interface {
+	// Called when an operation starts. The returned function, if not nil, is called when the operation ends with the
+	// final Span and the operation's error.
+	StartSpan(s Span) func(s Span, err error)
+}
+
+type readerStats struct {
+	reads, bytesRead                           atomic.Uint64
+	metadataBlocks, dataBlocks, fragmentBlocks atomic.Uint64
+	metadataTime, dataTime, fragmentTime       atomic.Int64
+	decompressBytes                            atomic.Uint64
+	inodes, directories                        atomic.Uint64
+	tableHits, tableMisses                     atomic.Uint64
+	prefetchHits, prefetchMisses               atomic.Uint64
+	tracer                                     Tracer
+}
+
+// Returns counters of the work done by the Reader and any copies of it.
+func (r Reader) Stats() Stats {
+	s := r.stats
+	return Stats{
+		CompType:        r.Superblock.CompType,
+		Reads:           s.reads.Load(),
+		BytesRead:       s.bytesRead.Load(),
+		MetadataBlocks:  s.metadataBlocks.Load(),
+		DataBlocks:      s.dataBlocks.Load(),
+		FragmentBlocks:  s.fragmentBlocks.Load(),
+		MetadataTime:    time.Duration(s.metadataTime.Load()),
+		DataTime:        time.Duration(s.dataTime.Load()),
+		FragmentTime:    time.Duration(s.fragmentTime.Load()),
+		DecompressBytes: s.decompressBytes.Load(),
+		Inodes:          s.inodes.Load(),
+		Directories:     s.directories.Load(),
+		TableHits:       s.tableHits.Load(),
+		TableMisses:     s.tableMisses.Load(),
+		PrefetchHits:    s.prefetchHits.Load(),
+		PrefetchMisses:  s.prefetchMisses.Load(),
+	}
+}
+
+func (s *readerStats) start(sp Span) func(Span, error) {
+	if s.tracer == nil {
+		return nil
+	}
+	return s.tracer.StartSpan(sp)
+}
+
+// Counts reads from the archive's io.ReaderAt.
+type statReader struct {
+	r     io.ReaderAt
+	stats *readerStats
+}
+
+func (s statReader) ReadAt(p []byte, off int64) (int, error) {
+	sp := Span{Kind: ReadSpan, Offset: uint64(off), Size: uint64(len(p))}
+	end := s.stats.start(sp)
+	n, err := s.r.ReadAt(p, off)
+	s.stats.reads.Add(1)
+	s.stats.bytesRead.Add(uint64(n))
+	if end != nil {
+		end(sp, err)
+	}
+	return n, err
+}
+
+// Keeps memory mapped archives from being copied.
+func (s statReader) Slice(off int64, n int) ([]byte, error) {
+	sp := Span{Kind: ReadSpan, Offset: uint64(off), Size: uint64(n)}
+	end := s.stats.start(sp)
+	out, err := toreader.ReadSlice(s.r, off, n)
+	s.stats.reads.Add(1)
+	s.stats.bytesRead.Add(uint64(len(out)))
+	if end != nil {
+		end(sp, err)
+	}
+	return out, err
+}
+
+// Counts and times decompression of a single kind of block.
+type statDecompressor struct {
+	d      Decompressor
+	kind   SpanKind
+	comp   uint16
+	blocks *atomic.Uint64
+	time   *atomic.Int64
+	stats  *readerStats
+}
+
+func newStatDecompressor(d Decompressor, kind SpanKind, comp uint16, stats *readerStats) statDecompressor {
+	out := statDecompressor{d: d, kind: kind, comp: comp, stats: stats}
+	switch kind {
+	case MetadataSpan:
+		out.blocks, out.time = &stats.metadataBlocks, &stats.metadataTime
+	case DataSpan:
+		out.blocks, out.time = &stats.dataBlocks, &stats.dataTime
+	default:
+		out.blocks, out.time = &stats.fragmentBlocks, &stats.fragmentTime
+	}
+	return out
+}
+
+func (s statDecompressor) Decompress(dat []byte) ([]byte, error) {
+	sp := Span{Kind: s.kind, Size: uint64(len(dat)), CompType: s.comp}
+	end := s.stats.start(sp)
+	start := time.Now()
+	out, err := s.d.Decompress(dat)
+	s.time.Add(int64(time.Since(start)))
+	s.blocks.Add(1)
+	s.stats.decompressBytes.Add(uint64(len(dat)))
+	if end != nil {
+		end(sp, err)
+	}
+	return out, err
+}
+
+func (r Reader) readInode(rdr *metadata.Reader) (inode.Inode, error) {
+	sp := Span{Kind: InodeSpan}
+	end := r.stats.start(sp)
+	i, err := inode.Read(rdr, r.Superblock.BlockSize)
+	r.stats.inodes.Add(1)
+	if err == nil {
+		sp.Inode = i.Num
+		if r.trace != nil {
+			r.trace.inode(i.Num)
+		}
+	}
+	if end != nil {
+		end(sp, err)
+	}
+	return i, err
+}
+
+func (r Reader) readDirectory(rdr *metadata.Reader, size uint32) ([]directory.Entry, error) {
+	sp := Span{Kind: DirectorySpan}
+	end := r.stats.start(sp)
+	entries, err := directory.ReadDirectory(rdr, size)
+	r.stats.directories.Add(1)
+	if end != nil {
+		end(sp, err)
+	}
+	return entries, err
+}
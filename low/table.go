@@ -47,9 +47,11 @@ func (t *Table[T]) Get(requestedItemIndex uint32) (T, error) {
 	}
 	if uint32(len(t.currentItems)) > requestedItemIndex {
 		t.mut.RUnlock()
+		t.rdr.stats.tableHits.Add(1)
 		return t.currentItems[requestedItemIndex], nil
 	}
 	t.mut.RUnlock()
+	t.rdr.stats.tableMisses.Add(1)
 	return t.fillAndGet(requestedItemIndex)
 }
 
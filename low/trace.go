@@ -0,0 +1,430 @@
+package squashfslow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const traceHeader = "squashfs-trace 1"
+
+type TraceEventType uint8
+
+const (
+	// A range of the archive was read.
+	TraceRead = TraceEventType(iota)
+	// An inode was decoded.
+	TraceInode
+)
+
+// A single event in a Trace.
+type TraceEvent struct {
+	Type   TraceEventType
+	Offset uint64 // The offset of the read. Only for TraceRead.
+	Size   uint32 // The size of the read. Only for TraceRead.
+	Inode  uint32 // The inode's number. Only for TraceInode.
+}
+
+// An ordered record of the reads made by a Reader. Sequential reads are combined into a single event and repeated reads are ignored.
+//
+// A Trace can be saved with WriteTo and given to ReaderOptions.Prefetch on a later open
+// so the same data is read in the background before it's requested.
+type Trace struct {
+	// Identifies the archive the trace was recorded from.
+	ArchiveSize uint64
+	ModTime     uint32
+	Events      []TraceEvent
+}
+
+// Reads a trace saved with Trace.WriteTo.
+func ReadTrace(r io.Reader) (*Trace, error) {
+	scan := bufio.NewScanner(r)
+	if !scan.Scan() || scan.Text() != traceHeader {
+		return nil, errors.New("not a squashfs trace")
+	}
+	out := &Trace{}
+	invalid := func(line string) error {
+		return errors.New("invalid trace line: " + line)
+	}
+	if !scan.Scan() {
+		return nil, errors.Join(errors.New("trace is missing archive identity"), scan.Err())
+	}
+	_, err := fmt.Sscanf(scan.Text(), "archive %d %d", &out.ArchiveSize, &out.ModTime)
+	if err != nil {
+		return nil, invalid(scan.Text())
+	}
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		switch {
+		case len(fields) == 3 && fields[0] == "r":
+			off, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, invalid(scan.Text())
+			}
+			size, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				return nil, invalid(scan.Text())
+			}
+			out.Events = append(out.Events, TraceEvent{Type: TraceRead, Offset: off, Size: uint32(size)})
+		case len(fields) == 2 && fields[0] == "i":
+			num, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, invalid(scan.Text())
+			}
+			out.Events = append(out.Events, TraceEvent{Type: TraceInode, Inode: uint32(num)})
+		case len(fields) == 0:
+		default:
+			return nil, invalid(scan.Text())
+		}
+	}
+	return out, scan.Err()
+}
+
+// Writes the trace in a line based text format.
+func (t *Trace) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var wrote int64
+	n, _ := fmt.Fprintf(bw, "%s\narchive %d %d\n", traceHeader, t.ArchiveSize, t.ModTime)
+	wrote += int64(n)
+	for _, e := range t.Events {
+		switch e.Type {
+		case TraceRead:
+			n, _ = fmt.Fprintf(bw, "r %d %d\n", e.Offset, e.Size)
+		case TraceInode:
+			n, _ = fmt.Fprintf(bw, "i %d\n", e.Inode)
+		}
+		wrote += int64(n)
+	}
+	return wrote, bw.Flush()
+}
+
+// Returns whether the trace was recorded from the given Reader's archive.
+func (t *Trace) Matches(r Reader) bool {
+	return t.ArchiveSize == r.Superblock.Size && t.ModTime == r.Superblock.ModTime
+}
+
+// Returns the trace recorded so far. Returns nil if ReaderOptions.RecordTrace wasn't set.
+// The returned Trace is a copy and is not updated by later reads.
+func (r Reader) Trace() *Trace {
+	if r.trace == nil {
+		return nil
+	}
+	r.trace.mut.Lock()
+	defer r.trace.mut.Unlock()
+	return &Trace{
+		ArchiveSize: r.Superblock.Size,
+		ModTime:     r.Superblock.ModTime,
+		Events:      slices.Clone(r.trace.events),
+	}
+}
+
+// Records reads made through it.
+type traceRecorder struct {
+	r      io.ReaderAt
+	mut    sync.Mutex
+	events []TraceEvent
+	seen   map[[2]uint64]bool
+	inodes map[uint32]bool
+}
+
+func newTraceRecorder(r io.ReaderAt) *traceRecorder {
+	return &traceRecorder{
+		r:      r,
+		seen:   make(map[[2]uint64]bool),
+		inodes: make(map[uint32]bool),
+	}
+}
+
+func (t *traceRecorder) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	if n == 0 {
+		return n, err
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	key := [2]uint64{uint64(off), uint64(n)}
+	if t.seen[key] {
+		return n, err
+	}
+	t.seen[key] = true
+	// Combine with the last read if it's directly after it, such as a metadata block after it's header.
+	if len(t.events) > 0 {
+		last := &t.events[len(t.events)-1]
+		if last.Type == TraceRead && last.Offset+uint64(last.Size) == uint64(off) && uint64(last.Size)+uint64(n) <= 1<<32-1 {
+			last.Size += uint32(n)
+			return n, err
+		}
+	}
+	t.events = append(t.events, TraceEvent{Type: TraceRead, Offset: uint64(off), Size: uint32(n)})
+	return n, err
+}
+
+func (t *traceRecorder) inode(num uint32) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.inodes[num] {
+		return
+	}
+	t.inodes[num] = true
+	t.events = append(t.events, TraceEvent{Type: TraceInode, Inode: num})
+}
+
+// How long prefetching waits for prefetched data to be read when it's at it's limit before giving up.
+const prefetchIdle = 10 * time.Second
+
+// Serves reads from data prefetched according to a Trace. Reads that aren't prefetched go to the underlying io.ReaderAt.
+type prefetcher struct {
+	r        io.ReaderAt
+	limit    uint64
+	mut      sync.Mutex
+	ranges   []prefetchRange // Sorted by offset. Ranges never overlap.
+	buffered uint64
+	consumed chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+	stats    *readerStats
+	logger   *slog.Logger
+}
+
+type prefetchRange struct {
+	off  uint64
+	dat  []byte
+	read [][2]int // The parts of dat that have been read. Sorted and merged.
+	used int      // The number of bytes covered by read.
+}
+
+func newPrefetcher(r io.ReaderAt, t *Trace, limit uint64, routines int, stats *readerStats, logger *slog.Logger) *prefetcher {
+	p := &prefetcher{
+		r:        r,
+		stats:    stats,
+		logger:   logger,
+		limit:    limit,
+		consumed: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go p.run(t, routines)
+	return p
+}
+
+// Stops prefetching and waits for reads in progress to finish. Prefetched data is dropped and later reads go to the
+// underlying io.ReaderAt.
+func (p *prefetcher) stop() {
+	p.stopOnce.Do(func() { close(p.done) })
+	<-p.stopped
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.ranges = nil
+	p.buffered = 0
+}
+
+func (p *prefetcher) run(t *Trace, routines int) {
+	defer close(p.stopped)
+	work := make(chan TraceEvent)
+	var wg sync.WaitGroup
+	for range routines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				dat := make([]byte, e.Size)
+				n, err := p.r.ReadAt(dat, int64(e.Offset))
+				if err != nil && err != io.EOF {
+					n = 0
+				}
+				p.add(e.Offset, dat[:n], e.Size)
+			}
+		}()
+	}
+	defer func() {
+		close(work)
+		wg.Wait()
+	}()
+	for _, e := range t.Events {
+		if e.Type != TraceRead || e.Size == 0 {
+			continue
+		}
+		for {
+			p.mut.Lock()
+			full := p.buffered+uint64(e.Size) > p.limit && p.buffered > 0
+			if full {
+				full = !p.evictUsed(uint64(e.Size))
+			}
+			if !full {
+				p.buffered += uint64(e.Size)
+			}
+			p.mut.Unlock()
+			if !full {
+				break
+			}
+			select {
+			case <-p.consumed:
+			case <-p.done:
+				return
+			case <-time.After(prefetchIdle):
+				// The prefetched data isn't being used. Likely the trace no longer matches how the archive is used.
+				p.logger.Info("prefetched data isn't being read, stopping prefetch", "op", "prefetch", "offset", e.Offset)
+				return
+			}
+		}
+		select {
+		case work <- e:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Adds prefetched data. requested is the amount of data that was requested, which has already been added to p.buffered.
+// Parts of dat that are already prefetched are dropped so ranges don't overlap.
+func (p *prefetcher) add(off uint64, dat []byte, requested uint32) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.buffered -= uint64(requested)
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	end := off + uint64(len(dat))
+	ind := p.search(off)
+	if ind > 0 {
+		ind--
+	}
+	for ; len(dat) > 0 && ind <= len(p.ranges); ind++ {
+		// Data before the next range, or after the last one, isn't prefetched yet.
+		next := end
+		if ind < len(p.ranges) {
+			next = min(next, p.ranges[ind].off)
+		}
+		if off < next {
+			piece := dat[:next-off]
+			p.ranges = slices.Insert(p.ranges, ind, prefetchRange{off: off, dat: piece})
+			p.buffered += uint64(len(piece))
+			dat, off = dat[len(piece):], next
+			ind++
+		}
+		if ind < len(p.ranges) {
+			if rngEnd := p.ranges[ind].end(); rngEnd > off {
+				skip := min(rngEnd, end) - off
+				dat, off = dat[skip:], off+skip
+			}
+		}
+	}
+	p.notify()
+}
+
+func (p *prefetcher) ReadAt(b []byte, off int64) (int, error) {
+	if p.serve(b, uint64(off)) {
+		p.stats.prefetchHits.Add(1)
+		return len(b), nil
+	}
+	p.stats.prefetchMisses.Add(1)
+	return p.r.ReadAt(b, off)
+}
+
+// Fills b from prefetched data if all of it is prefetched. b may span multiple adjacent ranges.
+// Ranges are kept after being read, since metadata is often read repeatedly, until room is needed for more data.
+func (p *prefetcher) serve(b []byte, off uint64) bool {
+	if len(b) == 0 {
+		return false
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	first := p.search(off)
+	if first == 0 || p.ranges[first-1].end() <= off {
+		return false
+	}
+	first--
+	end := off + uint64(len(b))
+	last := first
+	for p.ranges[last].end() < end {
+		if last+1 == len(p.ranges) || p.ranges[last+1].off != p.ranges[last].end() {
+			return false
+		}
+		last++
+	}
+	for i := first; i <= last; i++ {
+		rng := &p.ranges[i]
+		from, to := max(off, rng.off)-rng.off, min(end, rng.end())-rng.off
+		copy(b[max(off, rng.off)-off:], rng.dat[from:to])
+		if rng.markRead(int(from), int(to)) {
+			p.notify()
+		}
+	}
+	return true
+}
+
+// Returns the index of the first range that starts after off.
+// Must be called with p.mut locked.
+func (p *prefetcher) search(off uint64) int {
+	ind, found := slices.BinarySearchFunc(p.ranges, off, func(r prefetchRange, off uint64) int {
+		return compareUint(r.off, off)
+	})
+	if found {
+		ind++
+	}
+	return ind
+}
+
+// Removes ranges that have been fully read until size more bytes can be buffered. Returns false if there isn't enough room.
+// Must be called with p.mut locked.
+func (p *prefetcher) evictUsed(size uint64) bool {
+	for i := 0; i < len(p.ranges) && p.buffered+size > p.limit; {
+		if p.ranges[i].used < len(p.ranges[i].dat) {
+			i++
+			continue
+		}
+		p.buffered -= uint64(len(p.ranges[i].dat))
+		p.ranges = slices.Delete(p.ranges, i, i+1)
+	}
+	return p.buffered+size <= p.limit || p.buffered == 0
+}
+
+func (r *prefetchRange) end() uint64 {
+	return r.off + uint64(len(r.dat))
+}
+
+// Records that dat[from:to] has been read. Returns true if this is the read that completes the range.
+func (r *prefetchRange) markRead(from, to int) bool {
+	if r.used == len(r.dat) {
+		return false
+	}
+	// Merge with every interval that overlaps or touches [from, to).
+	lo, _ := slices.BinarySearchFunc(r.read, from, func(iv [2]int, from int) int {
+		return compareUint(uint64(iv[1]), uint64(from))
+	})
+	hi := lo
+	for hi < len(r.read) && r.read[hi][0] <= to {
+		from, to = min(from, r.read[hi][0]), max(to, r.read[hi][1])
+		r.used -= r.read[hi][1] - r.read[hi][0]
+		hi++
+	}
+	r.read = slices.Replace(r.read, lo, hi, [2]int{from, to})
+	r.used += to - from
+	return r.used == len(r.dat)
+}
+
+func (p *prefetcher) notify() {
+	select {
+	case p.consumed <- struct{}{}:
+	default:
+	}
+}
+
+func compareUint(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
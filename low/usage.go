@@ -0,0 +1,175 @@
+package squashfslow
+
+import (
+	"errors"
+	"path"
+)
+
+// Storage information about a single regular file.
+type FileUsage struct {
+	Path string
+	// The file's inode number. Hard links share the same number.
+	Inode uint32
+	// The file's uncompressed size.
+	Size uint64
+	// The number of bytes the file's data blocks take in the archive. Does not include the fragment.
+	DiskSize uint64
+	// The number of data blocks, not including the fragment.
+	Blocks uint32
+	// The number of data blocks stored without compression.
+	UncompressedBlocks uint32
+	// The number of data blocks that are entirely zeros and take no space.
+	SparseBlocks uint32
+	// The index of the fragment the file's tail is stored in. 0xFFFFFFFF if the file doesn't use a fragment.
+	FragIndex uint32
+	// The uncompressed size of the file's tail stored in the fragment.
+	FragSize uint32
+	// Whether the file is a hard link to an inode already reported in a previous FileUsage.
+	HardLink bool
+}
+
+// Whether the file's tail is stored in a fragment.
+func (f FileUsage) HasFragment() bool {
+	return f.FragIndex != 0xFFFFFFFF
+}
+
+// Storage information about a directory, including all files inside it and it's sub-directories.
+// Hard linked files are only counted once.
+type DirUsage struct {
+	Path     string
+	Size     uint64
+	DiskSize uint64
+	Files    uint32
+	Blocks   uint32
+	// The uncompressed bytes of tails stored in fragments.
+	FragSize uint64
+}
+
+// Archive wide storage information.
+type UsageTotals struct {
+	// The archive's size, as reported by the superblock.
+	ArchiveSize uint64
+	// Uncompressed size of all regular files. Hard links are only counted once.
+	Size uint64
+	// Bytes used by data blocks. Deduplicated blocks are only counted once.
+	Data uint64
+	// Bytes used by fragment blocks.
+	Fragments uint64
+	// Bytes used by the superblock, compression options, and all tables.
+	Metadata uint64
+	// Bytes used by each type of region.
+	Regions map[RegionType]uint64
+}
+
+// The results of Reader.Usage.
+type Usage struct {
+	// Every regular file, in the order Reader.Walk finds them.
+	Files []FileUsage
+	// Every directory, in the order Reader.Walk finds them.
+	Dirs   []DirUsage
+	Totals UsageTotals
+	dirInd map[string]int
+}
+
+// Analyzes how space is used in the archive, per file, per directory, and per region.
+// Requires reading every inode in the archive.
+func (r Reader) Usage() (*Usage, error) {
+	out := &Usage{
+		Totals: UsageTotals{
+			ArchiveSize: r.Superblock.Size,
+			Regions:     make(map[RegionType]uint64),
+		},
+		dirInd: make(map[string]int),
+	}
+	seen := make(map[uint32]bool)
+	dataBlocks := make(map[uint64]bool)
+	err := r.Walk(func(p string, b FileBase) error {
+		if b.IsDir() {
+			out.Dirs = append(out.Dirs, DirUsage{Path: p})
+			return nil
+		}
+		if !b.IsRegular() {
+			return nil
+		}
+		blockStart, sizes, fragIndex, _, fileSize := b.dataLayout()
+		fu := FileUsage{
+			Path:      p,
+			Inode:     b.Inode.Num,
+			Size:      fileSize,
+			Blocks:    uint32(len(sizes)),
+			FragIndex: fragIndex,
+			HardLink:  seen[b.Inode.Num],
+		}
+		seen[b.Inode.Num] = true
+		for _, s := range sizes {
+			realSize := s &^ (1 << 24)
+			if realSize == 0 {
+				fu.SparseBlocks++
+			} else if realSize != s {
+				fu.UncompressedBlocks++
+			}
+			fu.DiskSize += uint64(realSize)
+			if realSize != 0 && !dataBlocks[blockStart] {
+				dataBlocks[blockStart] = true
+				out.Totals.Data += uint64(realSize)
+			}
+			blockStart += uint64(realSize)
+		}
+		if fu.HasFragment() {
+			fu.FragSize = uint32(fileSize % uint64(r.Superblock.BlockSize))
+		}
+		out.Files = append(out.Files, fu)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range out.Dirs {
+		out.dirInd[out.Dirs[i].Path] = i
+	}
+	for _, f := range out.Files {
+		if f.HardLink {
+			continue
+		}
+		out.Totals.Size += f.Size
+		for dir := path.Dir(f.Path); ; dir = path.Dir(dir) {
+			d := &out.Dirs[out.dirInd[dir]]
+			d.Size += f.Size
+			d.DiskSize += f.DiskSize
+			d.Files++
+			d.Blocks += f.Blocks
+			d.FragSize += uint64(f.FragSize)
+			if dir == "." {
+				break
+			}
+		}
+	}
+	out.Totals.Regions[DataRegion] = out.Totals.Data
+	var ent fragEntry
+	for i := range r.Superblock.FragCount {
+		ent, err = r.fragEntry(i)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read fragment entry"), err)
+		}
+		out.Totals.Fragments += uint64(ent.Size &^ (1 << 24))
+	}
+	out.Totals.Regions[FragmentRegion] = out.Totals.Fragments
+	meta, err := r.metadataRegions()
+	if err != nil {
+		return nil, err
+	}
+	for _, reg := range meta {
+		out.Totals.Regions[reg.Type] += reg.End - reg.Start
+		out.Totals.Metadata += reg.End - reg.Start
+	}
+	return out, nil
+}
+
+// Returns the usage of the directory at the given path.
+func (u *Usage) Dir(p string) (DirUsage, bool) {
+	i, found := u.dirInd[p]
+	if !found {
+		return DirUsage{}, false
+	}
+	return u.Dirs[i], true
+}
@@ -0,0 +1,56 @@
+package squashfslow
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+)
+
+// Called for every file in the archive by Reader.Walk. p is the file's path relative to the root directory.
+// Returning fs.SkipDir skips the contents of the directory (or the rest of the parent directory if b isn't a directory).
+// Returning fs.SkipAll stops the walk without an error.
+type WalkFunc func(p string, b FileBase) error
+
+// Walks the archive's directory tree in lexical order, starting with the root directory as ".".
+// Unlike fs.WalkDir, every file's inode is read.
+func (r Reader) Walk(fn WalkFunc) error {
+	err := r.walkDir(".", r.Root, fn)
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (r Reader) walkDir(p string, d Directory, fn WalkFunc) error {
+	err := fn(p, d.FileBase)
+	if err != nil {
+		return err
+	}
+	var b FileBase
+	var subPath string
+	for _, e := range d.Entries {
+		b, err = r.BaseFromEntry(e)
+		if err != nil {
+			return errors.Join(errors.New("failed to read inode for "+path.Join(p, e.Name)), err)
+		}
+		subPath = path.Join(p, e.Name)
+		if !b.IsDir() {
+			err = fn(subPath, b)
+			if err == fs.SkipDir {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		sub, err := b.ToDir(r)
+		if err != nil {
+			return errors.Join(errors.New("failed to read directory "+subPath), err)
+		}
+		err = r.walkDir(subPath, sub, fn)
+		if err != nil && err != fs.SkipDir {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package squashfslow
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/CalebQ42/squashfs/internal/metadata"
+	"github.com/CalebQ42/squashfs/internal/toreader"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// Set on an xattr's type if it's value is stored elsewhere and only a reference to it is stored with it's name.
+const xattrOutOfLine = 0x100
+
+var xattrPrefixes = []string{"user.", "trusted.", "security."}
+
+// An extended attribute.
+type Xattr struct {
+	Name  string // The full name, including the namespace prefix such as "user.".
+	Value []byte
+}
+
+type xattrId struct {
+	Ref   uint64
+	Count uint32
+	Size  uint32
+}
+
+func readXattrId(r io.Reader) (xattrId, error) {
+	dat := make([]byte, 16)
+	_, err := io.ReadFull(r, dat)
+	if err != nil {
+		return xattrId{}, err
+	}
+	return xattrId{
+		Ref:   binary.LittleEndian.Uint64(dat[0:8]),
+		Count: binary.LittleEndian.Uint32(dat[8:12]),
+		Size:  binary.LittleEndian.Uint32(dat[12:16]),
+	}, nil
+}
+
+// Reads the xattr table's header. Does nothing if the archive doesn't have xattrs.
+func (r *Reader) initXattrs() error {
+	if r.Superblock.XattrTableStart == 0xFFFFFFFFFFFFFFFF || r.Superblock.NoXattrs() {
+		return nil
+	}
+	var hdr struct {
+		KvStart uint64
+		Count   uint32
+		_       uint32
+	}
+	err := binary.Read(toreader.NewReader(r.r, int64(r.Superblock.XattrTableStart)), binary.LittleEndian, &hdr)
+	if err != nil {
+		return err
+	}
+	r.xattrStart = hdr.KvStart
+	r.xattrTable = NewTable(r, r.Superblock.XattrTableStart+16, hdr.Count, readXattrId)
+	return nil
+}
+
+// Returns the xattrs of the given inode, in the order they're stored. Returns nil if the inode doesn't have any.
+func (r *Reader) Xattrs(i inode.Inode) ([]Xattr, error) {
+	ind := i.XattrIndex()
+	if ind == inode.NoXattr || r.xattrTable == nil {
+		return nil, nil
+	}
+	id, err := r.xattrTable.Get(ind)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read xattr id "+strconv.Itoa(int(ind))), err)
+	}
+	rdr, err := r.xattrReader(id.Ref)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	out := make([]Xattr, id.Count)
+	hdr := make([]byte, 4)
+	for i := range out {
+		_, err = io.ReadFull(rdr, hdr)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read xattr"), err)
+		}
+		typ, nameSize := binary.LittleEndian.Uint16(hdr), binary.LittleEndian.Uint16(hdr[2:])
+		if int(typ&0xFF) >= len(xattrPrefixes) {
+			return nil, errors.New("invalid xattr type " + strconv.Itoa(int(typ)))
+		}
+		name := make([]byte, nameSize)
+		_, err = io.ReadFull(rdr, name)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to read xattr name"), err)
+		}
+		out[i].Name = xattrPrefixes[typ&0xFF] + string(name)
+		out[i].Value, err = readXattrValue(rdr)
+		if err != nil {
+			return nil, err
+		}
+		if typ&xattrOutOfLine == xattrOutOfLine {
+			if len(out[i].Value) != 8 {
+				return nil, errors.New("invalid out of line xattr reference")
+			}
+			out[i].Value, err = r.outOfLineXattr(binary.LittleEndian.Uint64(out[i].Value))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// Returns a reader at the given reference into the xattr key/value metadata.
+func (r *Reader) xattrReader(ref uint64) (*metadata.Reader, error) {
+	rdr := metadata.NewReader(toreader.NewReader(r.r, int64(r.xattrStart+(ref>>16))), r.d)
+	_, err := io.ReadFull(&rdr, make([]byte, ref&0xFFFF))
+	if err != nil {
+		rdr.Close()
+		return nil, errors.Join(errors.New("failed to read xattrs"), err)
+	}
+	return &rdr, nil
+}
+
+func (r *Reader) outOfLineXattr(ref uint64) ([]byte, error) {
+	rdr, err := r.xattrReader(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	return readXattrValue(rdr)
+}
+
+func readXattrValue(r io.Reader) ([]byte, error) {
+	dat := make([]byte, 4)
+	_, err := io.ReadFull(r, dat)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read xattr value"), err)
+	}
+	out := make([]byte, binary.LittleEndian.Uint32(dat))
+	_, err = io.ReadFull(r, out)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to read xattr value"), err)
+	}
+	return out, nil
+}
+
+// Returns the file's xattrs. Returns nil if it doesn't have any.
+func (b FileBase) Xattrs(r *Reader) ([]Xattr, error) {
+	return r.Xattrs(b.Inode)
+}
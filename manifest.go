@@ -0,0 +1,237 @@
+package squashfs
+
+import (
+	"bufio"
+	"crypto"
+	_ "crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"runtime"
+	"strings"
+	"sync"
+
+	squashfslow "github.com/CalebQ42/squashfs/low"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+// Options for FS.Manifest.
+type ManifestOptions struct {
+	// The hash function used for regular files. Defaults to crypto.SHA256.
+	// Other hashes need their package to be imported, such as crypto/sha512.
+	Hash crypto.Hash
+	// Only include files that match the query.
+	Query Query
+	// The number of files hashed at once. Defaults to runtime.NumCPU().
+	Routines int
+}
+
+// A file in a Manifest. The embedded FileInfo gives the file's type, mode, owner, size, and symlink target.
+type ManifestEntry struct {
+	FileInfo
+	Path string // The file's path relative to the FS.
+	Hash []byte // The hash of the file's contents. Only set for regular files.
+	d    *DirEntry
+}
+
+// Returns the file's type as used by Manifest's JSON. One of file, dir, symlink, block, char, fifo, or socket.
+func (e ManifestEntry) TypeName() string {
+	switch e.fileType {
+	case inode.Fil, inode.EFil:
+		return "file"
+	case inode.Dir, inode.EDir:
+		return "dir"
+	case inode.Sym, inode.ESym:
+		return "symlink"
+	case inode.Block, inode.EBlock:
+		return "block"
+	case inode.Char, inode.EChar:
+		return "char"
+	case inode.Fifo, inode.EFifo:
+		return "fifo"
+	}
+	return "socket"
+}
+
+// Returns the file's unix permission bits, including the setuid, setgid, and sticky bits.
+func (e ManifestEntry) Perm() uint32 {
+	return e.perm & 0o7777
+}
+
+// A list of every file below a FS, along with the hash of each regular file.
+type Manifest struct {
+	Hash    crypto.Hash
+	Entries []ManifestEntry
+}
+
+// Walks the FS and hashes the contents of every regular file. Files are hashed concurrently and each file's data is
+// decompressed in parallel. Hard links are only hashed once. Entries are in the same order as fs.WalkDir.
+func (f FS) Manifest(op ManifestOptions) (Manifest, error) {
+	if op.Hash == 0 {
+		op.Hash = crypto.SHA256
+	}
+	if !op.Hash.Available() {
+		return Manifest{}, errors.New("hash function " + op.Hash.String() + " isn't available")
+	}
+	out := Manifest{Hash: op.Hash}
+	var err error
+	out.Entries, err = f.manifestEntries(op.Query)
+	if err != nil {
+		return out, err
+	}
+	return out, f.hashEntries(op.Hash, out.Entries, op.Routines)
+}
+
+// Returns the entries of every file matching q, without hashes.
+func (f FS) manifestEntries(q Query) (out []ManifestEntry, err error) {
+	err = f.Find(q, func(p string, d *DirEntry) error {
+		b, err := d.base()
+		if err != nil {
+			return &fs.PathError{Op: "manifest", Path: p, Err: err}
+		}
+		fi, err := f.r.fileInfoFromBase(b)
+		if err != nil {
+			return &fs.PathError{Op: "manifest", Path: p, Err: err}
+		}
+		out = append(out, ManifestEntry{FileInfo: fi, Path: p, d: d})
+		return nil
+	})
+	return
+}
+
+// Sets the Hash of every regular file in entries, hashing routines files at once.
+func (f FS) hashEntries(h crypto.Hash, entries []ManifestEntry, routines int) error {
+	if routines <= 0 {
+		routines = runtime.NumCPU()
+	}
+	// Regular files to hash, by inode number, with the indexes of their entries.
+	toHash := make(map[uint32][]int)
+	var order []uint32
+	for i, e := range entries {
+		if e.fileType != inode.Fil && e.fileType != inode.EFil {
+			continue
+		}
+		if _, has := toHash[e.num]; !has {
+			order = append(order, e.num)
+		}
+		toHash[e.num] = append(toHash[e.num], i)
+	}
+	var (
+		wg   sync.WaitGroup
+		mut  sync.Mutex
+		errs []error
+	)
+	work := make(chan uint32)
+	for range routines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := range work {
+				first := entries[toHash[num][0]]
+				b, err := first.d.base()
+				var sum []byte
+				if err == nil {
+					sum, err = hashBase(&f.r.Low, h, b)
+				}
+				mut.Lock()
+				if err != nil {
+					errs = append(errs, &fs.PathError{Op: "manifest", Path: first.Path, Err: err})
+				} else {
+					for _, i := range toHash[num] {
+						entries[i].Hash = sum
+					}
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	for _, num := range order {
+		work <- num
+	}
+	close(work)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func hashBase(r *squashfslow.Reader, h crypto.Hash, b squashfslow.FileBase) ([]byte, error) {
+	full, err := b.GetFullReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer full.Close()
+	hsh := h.New()
+	_, err = full.WriteTo(hsh)
+	if err != nil {
+		return nil, err
+	}
+	return hsh.Sum(nil), nil
+}
+
+// Writes the hashes of the manifest's regular files in the same format as sha256sum and similar tools,
+// so it can be checked with "sha256sum -c". Paths containing a backslash or newline are escaped the same as GNU coreutils.
+func (m Manifest) WriteSums(w io.Writer) error {
+	wr := bufio.NewWriter(w)
+	for _, e := range m.Entries {
+		if e.Hash == nil {
+			continue
+		}
+		p := e.Path
+		if strings.ContainsAny(p, "\\\n\r") {
+			wr.WriteByte('\\')
+			p = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(p)
+		}
+		_, err := fmt.Fprintf(wr, "%x  %s\n", e.Hash, p)
+		if err != nil {
+			return err
+		}
+	}
+	return wr.Flush()
+}
+
+type manifestJSON struct {
+	Hash    string              `json:"hash"`
+	Entries []manifestEntryJSON `json:"entries"`
+}
+
+type manifestEntryJSON struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Mode   string `json:"mode"`
+	Uid    uint32 `json:"uid"`
+	Gid    uint32 `json:"gid"`
+	Size   int64  `json:"size"`
+	Hash   string `json:"hash,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// Encodes the manifest as a JSON object with the hash's name and a list of entries.
+// Each entry has it's path, type, octal mode, uid, gid, size, hex encoded hash, and symlink target.
+func (m Manifest) MarshalJSON() ([]byte, error) {
+	out := manifestJSON{
+		Hash:    strings.ToLower(m.Hash.String()),
+		Entries: make([]manifestEntryJSON, len(m.Entries)),
+	}
+	for i, e := range m.Entries {
+		out.Entries[i] = manifestEntryJSON{
+			Path:   e.Path,
+			Type:   e.TypeName(),
+			Mode:   fmt.Sprintf("%04o", e.Perm()),
+			Uid:    e.uid,
+			Gid:    e.gid,
+			Size:   e.size,
+			Hash:   hex.EncodeToString(e.Hash),
+			Target: e.target,
+		}
+	}
+	return json.Marshal(out)
+}
+
+// Writes the manifest as indented JSON. See MarshalJSON.
+func (m Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package squashfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// A read-only memory mapped file. Implements toreader.Slicer so data can be used without copying it.
+// Reads after Close return os.ErrClosed. Slices that are kept after a call, such as a data.Reader's current block, are
+// copied by the low level readers so nothing references the mapping once it's unmapped.
+// Slices that are still in use when Close is called aren't tracked, so Close must not run concurrently with reads.
+type mmapFile struct {
+	mut sync.RWMutex
+	dat []byte
+}
+
+// Memory maps the file at path.
+func openMmap(path string) (io.ReaderAt, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+	dat, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, errors.Join(errors.New("failed to mmap file"), err)
+	}
+	out := &mmapFile{dat: dat}
+	return out, out, nil
+}
+
+func (m *mmapFile) ReadAt(p []byte, off int64) (int, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	if m.dat == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(m.dat)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.dat[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *mmapFile) Slice(off int64, n int) ([]byte, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	if m.dat == nil {
+		return nil, os.ErrClosed
+	}
+	if off < 0 {
+		return nil, errors.New("negative offset")
+	}
+	if off >= int64(len(m.dat)) {
+		return nil, io.EOF
+	}
+	if off+int64(n) > int64(len(m.dat)) {
+		return m.dat[off:], io.EOF
+	}
+	return m.dat[off : off+int64(n) : off+int64(n)], nil
+}
+
+func (m *mmapFile) Close() error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.dat == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.dat)
+	m.dat = nil
+	return err
+}
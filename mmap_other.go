@@ -0,0 +1,17 @@
+//go:build !linux
+
+package squashfs
+
+import (
+	"io"
+	"os"
+)
+
+// Memory mapping is only supported on Linux. Elsewhere the file is read normally.
+func openMmap(path string) (io.ReaderAt, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
@@ -0,0 +1,373 @@
+// Package mount provides an fs.FS made up of several squashfs archives mounted at different paths, such as a runtime archive
+// at "opt/runtime" and a plugin at "opt/plugins/foo". Directories leading to mount points exist even if no archive has
+// them, and a mount point hides whatever is at the same path in the archive it's mounted on.
+//
+// Unlike squashfs.FS, symlinks in the middle of a path are followed, even if they point into a different archive. Symlinks are
+// resolved against the whole mount table, so ".." in a symlink's target can leave the archive it's in and absolute targets
+// start at the mount table's root. The last element of a path is never followed, use FS.Resolve to follow it.
+package mount
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/squashfs"
+)
+
+// The maximum number of symlinks followed when resolving a path, the same as Linux.
+const maxLinks = 40
+
+var errLoop = errors.New("too many levels of symbolic links")
+
+// FS is a mount table of squashfs.FS.
+// Implements fs.ReadDirFS, fs.ReadFileFS, and fs.StatFS
+type FS struct {
+	mounts map[string]squashfs.FS
+	points []string // The mount points, sorted.
+}
+
+// Creates an FS with the given mount points. Mount points are paths relative to the FS's root, with "." mounting
+// an archive at the root. A squashfs.FS from FS.Sub can be mounted to only mount part of an archive.
+func New(mounts map[string]squashfs.FS) (FS, error) {
+	out := FS{mounts: make(map[string]squashfs.FS, len(mounts))}
+	for at, fsys := range mounts {
+		if !fs.ValidPath(at) {
+			return FS{}, &fs.PathError{Op: "mount", Path: at, Err: fs.ErrInvalid}
+		}
+		out.mounts[at] = fsys
+		out.points = append(out.points, at)
+	}
+	slices.Sort(out.points)
+	return out, nil
+}
+
+// Returns the archive that has the file at name, and the file's path in the archive.
+func (f FS) mountOf(name string) (fsys squashfs.FS, rel string, ok bool) {
+	best := ""
+	for _, p := range f.points {
+		if (p == "." || p == name || strings.HasPrefix(name, p+"/")) && (!ok || len(p) > len(best)) {
+			best, ok = p, true
+		}
+	}
+	if !ok {
+		return
+	}
+	rel = "."
+	if best != name {
+		rel = strings.TrimPrefix(name, best+"/")
+		if best == "." {
+			rel = name
+		}
+	}
+	return f.mounts[best], rel, true
+}
+
+// Returns the names of the directories in name that lead to mount points.
+func (f FS) children(name string) (out []string) {
+	for _, p := range f.points {
+		var rest string
+		if name == "." {
+			rest = p
+		} else if after, ok := strings.CutPrefix(p, name+"/"); ok {
+			rest = after
+		}
+		if rest == "" || rest == "." {
+			continue
+		}
+		first, _, _ := strings.Cut(rest, "/")
+		if !slices.Contains(out, first) {
+			out = append(out, first)
+		}
+	}
+	return
+}
+
+// Returns the file at name, without following any symlinks. fil is nil for directories that only exist because of mount points.
+// The fs.FileInfo's name is always path.Base(name).
+func (f FS) lstat(name string) (info fs.FileInfo, fil *squashfs.File, err error) {
+	_, isPoint := f.mounts[name]
+	fsys, rel, ok := f.mountOf(name)
+	if ok {
+		fil, err = fsys.OpenFile(rel)
+		if err == nil && (fil.IsDir() || len(f.children(name)) == 0) {
+			info, err = fil.Stat()
+			if err != nil {
+				return nil, nil, err
+			}
+			if isPoint {
+				info = namedInfo{FileInfo: info, name: path.Base(name)}
+			}
+			return info, fil, nil
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+	if name == "." || len(f.children(name)) > 0 {
+		return dirInfo{name: path.Base(name)}, nil, nil
+	}
+	return nil, nil, fs.ErrNotExist
+}
+
+// Returns name with all symlinks followed. If last is false, the last element isn't followed.
+func (f FS) resolve(name string, last bool) (string, error) {
+	done := "."
+	rest := name
+	links := 0
+	for rest != "" {
+		var part string
+		part, rest, _ = strings.Cut(rest, "/")
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			done = path.Dir(done)
+			continue
+		}
+		cur := path.Join(done, part)
+		if rest == "" && !last {
+			return cur, nil
+		}
+		_, fil, err := f.lstat(cur)
+		if err != nil {
+			return "", err
+		}
+		if fil == nil || !fil.IsSymlink() {
+			if fil != nil && !fil.IsDir() && rest != "" {
+				return "", fs.ErrNotExist
+			}
+			done = cur
+			continue
+		}
+		links++
+		if links > maxLinks {
+			return "", errLoop
+		}
+		target := fil.SymlinkPath()
+		if strings.HasPrefix(target, "/") {
+			done = "."
+		}
+		if rest != "" {
+			target += "/" + rest
+		}
+		rest = target
+	}
+	return done, nil
+}
+
+// Returns the file at name. Directories that are, or lead to, mount points are returned as a *Dir, other files as a *squashfs.File.
+func (f FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info, fil, err := f.lstat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	_, isPoint := f.mounts[full]
+	if fil != nil && !isPoint && len(f.children(full)) == 0 {
+		return fil, nil
+	}
+	return &Dir{f: f, name: name, full: full, info: info, fil: fil}, nil
+}
+
+// Returns the fs.FileInfo of the file at name. If name is a symlink, returns the symlink's fs.FileInfo.
+func (f FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	info, _, err := f.lstat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// Returns the contents of the directory at name, including the mount points in it.
+func (f FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	info, fil, err := f.lstat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	out, err := f.readDir(full, fil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return out, nil
+}
+
+// Returns the contents of the directory at name. fil is the directory in it's archive, if it has one.
+func (f FS) readDir(name string, fil *squashfs.File) ([]fs.DirEntry, error) {
+	children := f.children(name)
+	var out []fs.DirEntry
+	if fil != nil {
+		ents, err := fil.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range ents {
+			if !slices.Contains(children, e.Name()) {
+				out = append(out, e)
+			}
+		}
+	}
+	for _, c := range children {
+		info, _, err := f.lstat(path.Join(name, c))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(out, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return out, nil
+}
+
+// Returns the contents of the file at name.
+func (f FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	_, fil, err := f.lstat(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	if fil == nil || fil.IsDir() || fil.IsSymlink() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	defer fil.Close()
+	return io.ReadAll(fil)
+}
+
+// Returns the target of the symlink at name.
+func (f FS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, false)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	_, fil, err := f.lstat(full)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if fil == nil || !fil.IsSymlink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return fil.SymlinkPath(), nil
+}
+
+// Returns the path name points to with all symlinks followed, including the last element.
+// The returned path can be used with the FS's other functions.
+func (f FS) Resolve(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrInvalid}
+	}
+	full, err := f.resolve(name, true)
+	if err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: err}
+	}
+	if _, _, err = f.lstat(full); err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: err}
+	}
+	return full, nil
+}
+
+// A directory that is, or leads to, a mount point. Implements fs.ReadDirFile.
+type Dir struct {
+	f       FS
+	name    string
+	full    string
+	info    fs.FileInfo
+	fil     *squashfs.File
+	ents    []fs.DirEntry
+	entsSet bool
+	read    int
+}
+
+func (d *Dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+// Returns the next n entries, including mount points. If n <= 0 all remaining entries are returned. Otherwise, io.EOF
+// is returned once there are no more entries.
+func (d *Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.entsSet {
+		var err error
+		d.ents, err = d.f.readDir(d.full, d.fil)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entsSet = true
+	}
+	remaining := d.ents[d.read:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		remaining = remaining[:min(n, len(remaining))]
+	}
+	d.read += len(remaining)
+	return slices.Clone(remaining), nil
+}
+
+func (d *Dir) Close() error {
+	if d.fil != nil {
+		return d.fil.Close()
+	}
+	return nil
+}
+
+// An fs.FileInfo with a different name, for the roots of mounted archives.
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (n namedInfo) Name() string {
+	return n.name
+}
+
+// The fs.FileInfo of directories that only exist because of mount points.
+type dirInfo struct {
+	name string
+}
+
+func (d dirInfo) Name() string       { return d.name }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
@@ -0,0 +1,141 @@
+package mount
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/internal/testarchive"
+)
+
+const filePath = testarchive.FilePath
+
+func TestMounts(t *testing.T) {
+	rdr, err := squashfs.NewReader(testarchive.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := rdr.Sub("usr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(map[string]squashfs.FS{
+		".":             rdr.FS,
+		"opt/extra/usr": sub.(squashfs.FS),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := m.Stat("opt/extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Name() != "extra" {
+		t.Fatal("opt/extra should be a directory named extra")
+	}
+	ents, err := m.ReadDir("opt/extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 || ents[0].Name() != "usr" || !ents[0].IsDir() {
+		t.Fatal("opt/extra should only have usr")
+	}
+	want, err := rdr.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.ReadFile("opt/extra/" + filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("opt/extra/"+filePath, "isn't the same as", filePath)
+	}
+	err = fstest.TestFS(m, filePath, "opt/extra/"+filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New(map[string]squashfs.FS{"../opt": rdr.FS})
+	if err == nil {
+		t.Fatal("mounting at ../opt should fail")
+	}
+}
+
+// Mounts the testdata images. app.sqfs is at the root and has hello.txt, an empty opt directory, rt -> opt/runtime, and
+// abs -> /opt/runtime/lib/big.txt. runtime.sqfs is at opt/runtime and has lib/big.txt, lib/up -> ../../../hello.txt,
+// deep -> ../../../../../../hello.txt, bin -> lib, and loop1 and loop2 pointing at each other.
+func openMounts(t *testing.T) FS {
+	mounts := make(map[string]squashfs.FS)
+	for name, at := range map[string]string{"app.sqfs": ".", "runtime.sqfs": "opt/runtime"} {
+		rdr, err := squashfs.OpenFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rdr.Close() })
+		mounts[at] = rdr.FS
+	}
+	m, err := New(mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSymlinks(t *testing.T) {
+	m := openMounts(t)
+	for _, c := range []struct{ name, want, why string }{
+		{"rt/lib/big.txt", "opt/runtime/lib/big.txt", "a symlink in the middle of a path into another archive"},
+		{"rt/bin/big.txt", "opt/runtime/lib/big.txt", "two symlinks in the middle of a path"},
+		{"abs", "opt/runtime/lib/big.txt", "an absolute target"},
+		{"opt/runtime/lib/up", "hello.txt", "a target using .. to cross it's archive's mount point"},
+		{"rt/lib/up", "hello.txt", "a target using .. after following a symlink into the archive"},
+		{"opt/runtime/deep", "hello.txt", "a target using .. past the root"},
+	} {
+		got, err := m.Resolve(c.name)
+		if err != nil {
+			t.Fatal("resolving", c.why, "failed:", err)
+		}
+		if got != c.want {
+			t.Fatal("resolving", c.why, "returned", got, "instead of", c.want)
+		}
+	}
+	dat, err := m.ReadFile("rt/lib/big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dat) != "runtime\n" {
+		t.Fatal("rt/lib/big.txt is", string(dat))
+	}
+	info, err := m.Stat("rt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Type() != fs.ModeSymlink {
+		t.Fatal("the last element of a path was followed by Stat")
+	}
+	target, err := m.ReadLink("rt/lib/up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../../../hello.txt" {
+		t.Fatal("rt/lib/up's target is", target)
+	}
+	_, err = m.ReadLink("hello.txt")
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal("ReadLink of a regular file returned", err)
+	}
+	for _, name := range []string{"opt/runtime/loop1", "opt/runtime/loop2/x"} {
+		_, err = m.Resolve(name)
+		if !errors.Is(err, errLoop) {
+			t.Fatal("resolving", name, "returned", err, "instead of a loop error")
+		}
+	}
+	_, err = m.Stat("opt/runtime/loop1/x")
+	if !errors.Is(err, errLoop) {
+		t.Fatal("Stat through a loop returned", err, "instead of a loop error")
+	}
+}
@@ -0,0 +1,378 @@
+package squashfs
+
+import (
+	"bufio"
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The mtree digest keywords and their hashes.
+var mtreeDigests = []struct {
+	keyword string
+	hash    crypto.Hash
+}{
+	{"md5digest", crypto.MD5},
+	{"sha1digest", crypto.SHA1},
+	{"sha256digest", crypto.SHA256},
+	{"sha384digest", crypto.SHA384},
+	{"sha512digest", crypto.SHA512},
+}
+
+func mtreeDigestKeyword(h crypto.Hash) string {
+	for _, d := range mtreeDigests {
+		if d.hash == h {
+			return d.keyword
+		}
+	}
+	return ""
+}
+
+// Returns the file's type as used by mtree.
+func (e ManifestEntry) mtreeType() string {
+	if t := e.TypeName(); t != "symlink" {
+		return t
+	}
+	return "link"
+}
+
+// Writes an mtree specification of the FS, in the full path format created by "mtree -C". Every file, including the
+// FS's directory as ".", has the type, mode, uid, gid, time, and nlink keywords. Regular files also have size and a
+// digest of their contents, using op.Hash (sha256digest by default). Symlinks also have link.
+// Only md5, sha1, sha256, sha384, and sha512 can be used as the hash.
+func (f FS) WriteMtree(w io.Writer, op ManifestOptions) error {
+	if op.Hash == 0 {
+		op.Hash = crypto.SHA256
+	}
+	digest := mtreeDigestKeyword(op.Hash)
+	if digest == "" {
+		return errors.New("mtree doesn't support hash function " + op.Hash.String())
+	}
+	m, err := f.Manifest(op)
+	if err != nil {
+		return err
+	}
+	root, err := f.r.fileInfoFromBase(f.LowDir.FileBase)
+	if err != nil {
+		return err
+	}
+	wr := bufio.NewWriter(w)
+	wr.WriteString("#mtree\n")
+	for _, e := range append([]ManifestEntry{{FileInfo: root, Path: "."}}, m.Entries...) {
+		p := "."
+		if e.Path != "." {
+			p = "./" + e.Path
+		}
+		fmt.Fprintf(wr, "%s type=%s mode=%04o uid=%d gid=%d", mtreeEscape(p), e.mtreeType(), e.Perm(), e.uid, e.gid)
+		if e.Hash != nil {
+			fmt.Fprintf(wr, " size=%d", e.size)
+		}
+		fmt.Fprintf(wr, " time=%d.000000000 nlink=%d", e.modTime, e.links)
+		if e.IsSymlink() {
+			fmt.Fprintf(wr, " link=%s", mtreeEscape(e.target))
+		}
+		if e.Hash != nil {
+			fmt.Fprintf(wr, " %s=%x", digest, e.Hash)
+		}
+		_, err = wr.WriteString("\n")
+		if err != nil {
+			return err
+		}
+	}
+	return wr.Flush()
+}
+
+// Escapes whitespace, non-printable characters, backslashes, #, and glob characters as \ooo, the same as mtree.
+func mtreeEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`\#*?[`, c) != -1 {
+			fmt.Fprintf(&b, "\\%03o", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func mtreeUnescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i:i+3], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		switch s[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+type mtreeEntry struct {
+	path     string
+	keywords map[string]string
+}
+
+// Parses an mtree specification in either the full path format or the hierarchical format created by "mtree -c".
+func parseMtree(r io.Reader) (out []mtreeEntry, err error) {
+	set := make(map[string]string)
+	var dir []string
+	var line string
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1024*1024)
+	for num := 1; scan.Scan(); num++ {
+		line += scan.Text()
+		if strings.HasSuffix(line, "\\") {
+			line = line[:len(line)-1] + " "
+			continue
+		}
+		fields := strings.Fields(line)
+		line = ""
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "/set":
+			for _, kv := range fields[1:] {
+				k, v, _ := strings.Cut(kv, "=")
+				set[k] = v
+			}
+			continue
+		case "/unset":
+			for _, k := range fields[1:] {
+				if k == "all" {
+					clear(set)
+				}
+				delete(set, k)
+			}
+			continue
+		case "..":
+			if len(dir) == 0 {
+				return nil, errors.New("line " + strconv.Itoa(num) + ": .. above the root directory")
+			}
+			dir = dir[:len(dir)-1]
+			continue
+		}
+		if strings.HasPrefix(fields[0], "/") {
+			return nil, errors.New("line " + strconv.Itoa(num) + ": unknown command " + fields[0])
+		}
+		e := mtreeEntry{keywords: make(map[string]string, len(set)+len(fields))}
+		for k, v := range set {
+			e.keywords[k] = v
+		}
+		for _, kv := range fields[1:] {
+			k, v, _ := strings.Cut(kv, "=")
+			e.keywords[k] = v
+		}
+		name := mtreeUnescape(fields[0])
+		if strings.Contains(fields[0], "/") {
+			e.path = path.Clean(name)
+		} else {
+			e.path = path.Join(append(dir, name)...)
+			if e.keywords["type"] == "dir" {
+				dir = append(dir, name)
+			}
+		}
+		out = append(out, e)
+	}
+	return out, scan.Err()
+}
+
+// The kind of an MtreeDiff.
+type MtreeDiffKind uint8
+
+const (
+	MtreeMissing  MtreeDiffKind = iota // The file is in the spec, but not the FS.
+	MtreeExtra                         // The file is in the FS, but not the spec.
+	MtreeMismatch                      // One of the file's keywords doesn't match the spec.
+)
+
+// A difference between a FS and an mtree specification, found by FS.VerifyMtree.
+type MtreeDiff struct {
+	Path string
+	Kind MtreeDiffKind
+	// For MtreeMismatch, the keyword that doesn't match, and it's value in the spec and FS.
+	Keyword, Want, Got string
+}
+
+func (d MtreeDiff) String() string {
+	switch d.Kind {
+	case MtreeMissing:
+		return "missing: " + d.Path
+	case MtreeExtra:
+		return "extra: " + d.Path
+	}
+	return d.Path + ": " + d.Keyword + " expected " + d.Want + ", found " + d.Got
+}
+
+// Compares the FS against an mtree specification. Returns the files in the spec that aren't in the FS, the files in the
+// FS that aren't in the spec, and one MtreeDiff for each keyword that doesn't match.
+//
+// The type, mode, uid, gid, size, time, link, nlink, and md5, sha1, sha256, sha384, and sha512 digest keywords are
+// checked, other keywords are ignored. Sizes and digests are only checked for regular files and times are only checked
+// to the second. Files with the optional keyword can be missing, and the contents of directories with the ignore keyword
+// aren't checked. If the spec has digests, the files are hashed concurrently.
+func (f FS) VerifyMtree(spec io.Reader) ([]MtreeDiff, error) {
+	entries, err := parseMtree(spec)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to parse mtree spec"), err)
+	}
+	man, err := f.manifestEntries(Query{})
+	if err != nil {
+		return nil, err
+	}
+	root, err := f.r.fileInfoFromBase(f.LowDir.FileBase)
+	if err != nil {
+		return nil, err
+	}
+	man = append(man, ManifestEntry{FileInfo: root, Path: "."})
+	// The hex digests of each regular file, by keyword then path.
+	digests := make(map[string]map[string]string)
+	for _, d := range mtreeDigests {
+		needed := false
+		for _, e := range entries {
+			if _, has := e.keywords[d.keyword]; has {
+				needed = true
+				break
+			}
+		}
+		if !needed {
+			continue
+		}
+		err = f.hashEntries(d.hash, man, 0)
+		if err != nil {
+			return nil, err
+		}
+		digests[d.keyword] = make(map[string]string)
+		for _, e := range man {
+			if e.Hash != nil {
+				digests[d.keyword][e.Path] = hex.EncodeToString(e.Hash)
+			}
+		}
+	}
+	byPath := make(map[string]ManifestEntry, len(man))
+	for _, e := range man {
+		byPath[e.Path] = e
+	}
+	var out []MtreeDiff
+	inSpec := make(map[string]bool, len(entries))
+	var ignored []string
+	for _, e := range entries {
+		inSpec[e.path] = true
+		if _, has := e.keywords["ignore"]; has {
+			ignored = append(ignored, e.path)
+		}
+		fil, has := byPath[e.path]
+		if !has {
+			if _, optional := e.keywords["optional"]; !optional {
+				out = append(out, MtreeDiff{Path: e.path, Kind: MtreeMissing})
+			}
+			continue
+		}
+		out = append(out, fil.mtreeDiffs(e, digests)...)
+	}
+	for _, e := range man {
+		if inSpec[e.Path] {
+			continue
+		}
+		ign := false
+		for _, dir := range ignored {
+			if dir == "." || strings.HasPrefix(e.Path, dir+"/") {
+				ign = true
+				break
+			}
+		}
+		if !ign {
+			out = append(out, MtreeDiff{Path: e.Path, Kind: MtreeExtra})
+		}
+	}
+	return out, nil
+}
+
+func (e ManifestEntry) mtreeDiffs(spec mtreeEntry, digests map[string]map[string]string) (out []MtreeDiff) {
+	mismatch := func(keyword, want, got string) {
+		out = append(out, MtreeDiff{Path: e.Path, Kind: MtreeMismatch, Keyword: keyword, Want: want, Got: got})
+	}
+	if want, has := spec.keywords["type"]; has && want != e.mtreeType() {
+		// Nothing else is worth comparing.
+		mismatch("type", want, e.mtreeType())
+		return
+	}
+	regular := e.mtreeType() == "file"
+	for _, k := range slices.Sorted(maps.Keys(spec.keywords)) {
+		want := spec.keywords[k]
+		var got string
+		switch k {
+		case "mode":
+			got = fmt.Sprintf("%04o", e.Perm())
+			if v, err := strconv.ParseUint(want, 8, 32); err == nil && uint32(v) == e.Perm() {
+				continue
+			}
+		case "uid":
+			got = strconv.FormatUint(uint64(e.uid), 10)
+		case "gid":
+			got = strconv.FormatUint(uint64(e.gid), 10)
+		case "size":
+			if !regular {
+				continue
+			}
+			got = strconv.FormatInt(e.size, 10)
+		case "time":
+			got = strconv.FormatUint(uint64(e.modTime), 10)
+			if sec, _, _ := strings.Cut(want, "."); sec == got {
+				continue
+			}
+		case "link":
+			if !e.IsSymlink() {
+				continue
+			}
+			want = mtreeUnescape(want)
+			got = e.target
+		case "nlink":
+			got = strconv.FormatUint(uint64(e.links), 10)
+		default:
+			d, isDigest := digests[k]
+			if !isDigest || !regular {
+				continue
+			}
+			want = strings.ToLower(want)
+			got = d[e.Path]
+		}
+		if want != got {
+			mismatch(k, want, got)
+		}
+	}
+	return
+}
@@ -0,0 +1,409 @@
+// Package overlay provides an fs.FS that merges several squashfs archives, the same as overlayfs. Each archive is a layer and
+// files in higher layers hide the same files in lower layers. Directories are merged.
+//
+// Files are deleted from lower layers by a whiteout in a higher layer, either a character device with the device number 0/0
+// or an empty file named ".wh." followed by the deleted file's name. A directory is opaque, hiding the same directory in lower
+// layers, if it has the trusted.overlay.opaque xattr set to "y" or contains a file named ".wh..wh..opq".
+//
+// Symlinks are never followed, so a symlink to a directory can't be used as part of a path.
+package overlay
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/internal/fileattr"
+	"github.com/CalebQ42/squashfs/internal/pathmatch"
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = ".wh..wh..opq"
+	opaqueXattr    = "trusted.overlay.opaque"
+)
+
+// FS is a merged view of several squashfs.FS.
+// Implements fs.GlobFS, fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, and fs.SubFS
+type FS struct {
+	layers []squashfs.FS
+	dir    string // The FS's directory in the layers. "." for the root.
+}
+
+// Creates an FS from the given layers, highest priority first. A Reader's FS can be used as a layer,
+// such as New(upper.FS, lower.FS).
+func New(layers ...squashfs.FS) FS {
+	return FS{
+		layers: layers,
+		dir:    ".",
+	}
+}
+
+// Returns the layers that make up the file at name, relative to the layers' roots, highest priority first.
+// Non-directories, and opaque directories, are only made up of a single layer.
+func (f FS) resolve(name string) (layers []int, top *squashfs.File, err error) {
+	layers = make([]int, len(f.layers))
+	for i := range layers {
+		layers[i] = i
+	}
+	p := "."
+	parts := []string{"."}
+	if name != "." {
+		parts = append(parts, strings.Split(name, "/")...)
+	}
+	for i, part := range parts {
+		if top != nil && !top.IsDir() || strings.HasPrefix(part, whiteoutPrefix) {
+			return nil, nil, fs.ErrNotExist
+		}
+		p = path.Join(p, part)
+		layers, top, err = f.step(layers, p, i == 0)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return
+}
+
+// Returns the layers, out of the given layers, that have the file at p.
+func (f FS) step(layers []int, p string, root bool) (out []int, top *squashfs.File, err error) {
+	for _, i := range layers {
+		if !root {
+			if _, err := f.layers[i].Stat(path.Join(path.Dir(p), whiteoutPrefix+path.Base(p))); err == nil {
+				break
+			}
+		}
+		fil, err := f.layers[i].OpenFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if isWhiteout(fil) {
+			break
+		}
+		if top == nil {
+			top = fil
+		}
+		if !fil.IsDir() {
+			if len(out) == 0 {
+				out = append(out, i)
+			}
+			break
+		}
+		out = append(out, i)
+		opaque, err := f.isOpaque(i, p, fil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if opaque {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil, fs.ErrNotExist
+	}
+	return out, top, nil
+}
+
+// Returns whether the file is a character device with the device number 0/0.
+func isWhiteout(f *squashfs.File) bool {
+	switch dev := f.Low.Inode.Data.(type) {
+	case inode.Device:
+		return f.Low.Inode.Type == inode.Char && dev.Dev == 0
+	case inode.EDevice:
+		return f.Low.Inode.Type == inode.EChar && dev.Dev == 0
+	}
+	return false
+}
+
+func (f FS) isOpaque(layer int, p string, dir *squashfs.File) (bool, error) {
+	if _, err := f.layers[layer].Stat(path.Join(p, opaqueMarker)); err == nil {
+		return true, nil
+	}
+	xattrs, err := dir.Xattrs()
+	if err != nil {
+		return false, err
+	}
+	for _, x := range xattrs {
+		if x.Name == opaqueXattr && string(x.Value) == "y" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns the merged entries of the directory at name, relative to the layers' roots, sorted by name.
+func (f FS) readDir(name string, layers []int) ([]fs.DirEntry, error) {
+	var out []fs.DirEntry
+	// Names already found, or whited out, in a higher layer.
+	seen := make(map[string]bool)
+	for _, i := range layers {
+		ents, err := f.layers[i].ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		// Whiteouts also hide files in their own layer, the same as step, so they're found before any entries are added.
+		for _, e := range ents {
+			if deleted, ok := strings.CutPrefix(e.Name(), whiteoutPrefix); ok && e.Name() != opaqueMarker {
+				seen[deleted] = true
+			}
+		}
+		for _, e := range ents {
+			n := e.Name()
+			if strings.HasPrefix(n, whiteoutPrefix) {
+				continue
+			}
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			if e.Type()&fs.ModeDevice != 0 {
+				fil, err := f.layers[i].OpenFile(path.Join(name, n))
+				if err != nil {
+					return nil, err
+				}
+				if isWhiteout(fil) {
+					continue
+				}
+			}
+			out = append(out, e)
+		}
+	}
+	slices.SortFunc(out, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return out, nil
+}
+
+// Returns the file at name. Directories are returned as a *Dir, other files as the *squashfs.File from the highest layer that has it.
+func (f FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	full := path.Join(f.dir, name)
+	layers, top, err := f.resolve(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !top.IsDir() {
+		return top, nil
+	}
+	return &Dir{f: f, name: name, full: full, layers: layers, top: top}, nil
+}
+
+// Returns the merged contents of the directory at name.
+func (f FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	full := path.Join(f.dir, name)
+	layers, top, err := f.resolve(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !top.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	out, err := f.readDir(full, layers)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return out, nil
+}
+
+// Returns the contents of the file at name, from the highest layer that has it.
+func (f FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	full := path.Join(f.dir, name)
+	layers, _, err := f.resolve(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return f.layers[layers[0]].ReadFile(full)
+}
+
+// Returns the fs.FileInfo of the file at name, from the highest layer that has it.
+func (f FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, top, err := f.resolve(path.Join(f.dir, name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return top.Stat()
+}
+
+// Returns the merged FS at dir.
+func (f FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	full := path.Join(f.dir, dir)
+	_, top, err := f.resolve(full)
+	if err != nil {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: err}
+	}
+	if !top.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errors.New("not a directory")}
+	}
+	return FS{layers: f.layers, dir: full}, nil
+}
+
+// Returns the paths of the files matching the pattern. Uses path.Match to compare names.
+// Same as squashfs.FS.Glob, a ** component matches any number of directories.
+func (f FS) Glob(pattern string) (out []string, err error) {
+	if _, err = path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		if _, err = f.Stat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+	patParts := strings.Split(pattern, "/")
+	err = fs.WalkDir(f, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		parts := strings.Split(p, "/")
+		if pathmatch.MatchParts(patParts, parts, false) {
+			out = append(out, p)
+		}
+		if d.IsDir() && !pathmatch.MatchParts(patParts, parts, true) {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return
+}
+
+// Extracts the merged contents of the FS to folder. Directories are created with the permissions, owner, and modification
+// time of the highest layer that has them. Other files are extracted from the highest layer that has them using
+// squashfs.File.ExtractWithOptions, so op applies the same. If op is nil, squashfs.DefaultOptions is used.
+func (f FS) Extract(folder string, op *squashfs.ExtractionOptions) error {
+	if op == nil {
+		op = squashfs.DefaultOptions()
+	}
+	err := os.MkdirAll(folder, 0777)
+	if err != nil {
+		return err
+	}
+	return f.extract(".", folder, op)
+}
+
+func (f FS) extract(name, folder string, op *squashfs.ExtractionOptions) error {
+	ents, err := f.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, e := range ents {
+		p := path.Join(name, e.Name())
+		if !e.IsDir() {
+			fil, err := f.Open(p)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			err = fil.(*squashfs.File).ExtractWithOptions(folder, op)
+			fil.Close()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		dir := filepath.Join(folder, e.Name())
+		err = os.Mkdir(dir, 0777)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			errs = append(errs, errors.Join(errors.New("failed to create directory: "+dir), err))
+			continue
+		}
+		err = f.extract(p, dir, op)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		// Set after the directory's contents are extracted, so a read-only directory can still be filled and extracting
+		// it's contents doesn't change it's modification time.
+		_, top, err := f.resolve(path.Join(f.dir, p))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !op.IgnorePerm {
+			info, err := top.Stat()
+			if err != nil {
+				top.Close()
+				errs = append(errs, err)
+				continue
+			}
+			fileattr.SetPerm(dir, top.Low.Inode, info.(squashfs.FileInfo).Uid(), info.(squashfs.FileInfo).Gid())
+		}
+		err = fileattr.SetModTime(dir, top.Low.Inode)
+		top.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// A merged directory returned by FS.Open. Implements fs.ReadDirFile.
+type Dir struct {
+	f       FS
+	name    string
+	full    string
+	layers  []int
+	top     *squashfs.File
+	ents    []fs.DirEntry
+	entsSet bool
+	read    int
+}
+
+// Returns the fs.FileInfo of the directory from the highest layer.
+func (d *Dir) Stat() (fs.FileInfo, error) {
+	return d.top.Stat()
+}
+
+func (d *Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+// Returns the next n merged entries. If n <= 0 all remaining entries are returned. Otherwise, io.EOF is returned
+// once there are no more entries.
+func (d *Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.entsSet {
+		var err error
+		d.ents, err = d.f.readDir(d.full, d.layers)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entsSet = true
+	}
+	remaining := d.ents[d.read:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		remaining = remaining[:min(n, len(remaining))]
+	}
+	d.read += len(remaining)
+	return slices.Clone(remaining), nil
+}
+
+func (d *Dir) Close() error {
+	return d.top.Close()
+}
@@ -0,0 +1,247 @@
+package overlay
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CalebQ42/squashfs"
+	"github.com/CalebQ42/squashfs/internal/testarchive"
+)
+
+const filePath = testarchive.FilePath
+
+// Opens an image from testdata. The images are three layers, highest first:
+//
+//	upper.sqfs: hello.txt replaced, usr/lib/.wh.libfoo.so, 0/0 character devices at lib and usr/null2,
+//	  a/b made opaque with a/b/.wh..wh..opq and containing only.txt, and usr/lib/added.txt.
+//	middle.sqfs: "dir with space" made opaque with the trusted.overlay.opaque xattr, usr/bin/.wh.foolink,
+//	  newdir/x, and usr/lib-mid.txt.
+//	base.sqfs: hello.txt, usr/lib/libfoo.so, usr/lib/keep.so, usr/bin/foolink, usr/bin/tool, usr/null2, lib,
+//	  a/b/lower.txt, a/b/c/deep.txt, and "dir with space/file name.txt".
+//
+// whiteout.sqfs is used above base.sqfs. It has gone.txt and .wh.gone.txt, usr/lib/keep.so and usr/lib/.wh.keep.so,
+// kept.txt, and shared/file.txt, where shared has the setgid and sticky bits set. Everything's modified at 1600000000.
+func openImage(t *testing.T, name string) squashfs.Reader {
+	rdr, err := squashfs.OpenFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rdr.Close() })
+	return rdr
+}
+
+func openLayers(t *testing.T) FS {
+	return New(openImage(t, "upper.sqfs").FS, openImage(t, "middle.sqfs").FS, openImage(t, "base.sqfs").FS)
+}
+
+func TestMerge(t *testing.T) {
+	rdr, err := squashfs.NewReader(testarchive.Open(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := rdr.Sub("usr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := New(sub.(squashfs.FS), rdr.FS)
+	want, err := rdr.FS.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := o.ReadFile("sbin/add-shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("sbin/add-shell isn't the same as", filePath)
+	}
+	// The root should have the entries of both usr and the archive's root.
+	var wantNames []string
+	for _, dir := range []string{".", "usr"} {
+		ents, err := rdr.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range ents {
+			wantNames = append(wantNames, e.Name())
+		}
+	}
+	slices.Sort(wantNames)
+	wantNames = slices.Compact(wantNames)
+	ents, err := o.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ents {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, wantNames) {
+		t.Fatal("root has", names, "instead of", wantNames)
+	}
+	err = fstest.TestFS(o, "sbin/add-shell", filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The files in the merged view of the testdata images.
+var layersWant = []string{
+	".",
+	"a",
+	"a/b",
+	"a/b/only.txt",
+	"dir with space",
+	"hello.txt",
+	"newdir",
+	"newdir/x",
+	"usr",
+	"usr/bin",
+	"usr/bin/tool",
+	"usr/lib",
+	"usr/lib/added.txt",
+	"usr/lib/keep.so",
+	"usr/lib-mid.txt",
+}
+
+func TestWhiteouts(t *testing.T) {
+	o := openLayers(t)
+	var got []string
+	err := fs.WalkDir(o, ".", func(p string, d fs.DirEntry, err error) error {
+		got = append(got, p)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, layersWant) {
+		t.Fatal("merged files are", got, "instead of", layersWant)
+	}
+	for _, c := range []struct{ name, why string }{
+		{"usr/lib/libfoo.so", "a .wh. file"},
+		{"usr/lib/.wh.libfoo.so", "a whiteout itself"},
+		{"usr/null2", "a 0/0 character device"},
+		{"lib", "a 0/0 character device hiding a symlink"},
+		{"a/b/lower.txt", "a .wh..wh..opq file"},
+		{"a/b/c/deep.txt", "a .wh..wh..opq file"},
+		{"a/b/.wh..wh..opq", "a whiteout itself"},
+		{"dir with space/file name.txt", "the trusted.overlay.opaque xattr"},
+		{"usr/bin/foolink", "a .wh. file in a middle layer"},
+	} {
+		_, err = o.Stat(c.name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error(c.name, "should be hidden by", c.why, "but Stat returned", err)
+		}
+	}
+	dat, err := o.ReadFile("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dat) != "upper\n" {
+		t.Fatal("hello.txt is", string(dat), "instead of the upper layer's")
+	}
+	err = fstest.TestFS(o, "hello.txt", "a/b/only.txt", "newdir/x", "usr/lib/keep.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	o := openLayers(t)
+	dir := t.TempDir()
+	err := o.Extract(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		got = append(got, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, layersWant) {
+		t.Fatal("extracted files are", got, "instead of", layersWant)
+	}
+	for _, name := range []string{"hello.txt", "usr/lib/keep.so", "a/b/only.txt"} {
+		want, err := o.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatal("extracted", name, "is different")
+		}
+	}
+}
+
+func TestSameLayerWhiteout(t *testing.T) {
+	o := New(openImage(t, "whiteout.sqfs").FS, openImage(t, "base.sqfs").FS)
+	for _, c := range []struct{ dir, name string }{
+		{".", "gone.txt"},
+		{"usr/lib", "keep.so"},
+	} {
+		p := path.Join(c.dir, c.name)
+		_, err := o.Stat(p)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error(p, "should be hidden by a whiteout in the same layer but Stat returned", err)
+		}
+		ents, err := o.ReadDir(c.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range ents {
+			if e.Name() == c.name {
+				t.Error(p, "is listed by ReadDir even though it's whited out in the same layer")
+			}
+		}
+	}
+	err := fstest.TestFS(o, "kept.txt", "shared/file.txt", "usr/lib/libfoo.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractDirAttrs(t *testing.T) {
+	o := New(openImage(t, "whiteout.sqfs").FS, openImage(t, "base.sqfs").FS)
+	dir := t.TempDir()
+	err := o.Extract(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(filepath.Join(dir, "shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fs.ModeSetgid | fs.ModeSticky; stat.Mode()&want != want {
+		t.Fatal("shared was extracted with mode", stat.Mode(), "without the setgid and sticky bits")
+	}
+	for _, name := range []string{"shared", "usr", "usr/lib"} {
+		want, err := o.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.ModTime().Equal(want.ModTime()) {
+			t.Fatal(name, "was extracted with modification time", got.ModTime(), "instead of", want.ModTime())
+		}
+	}
+}
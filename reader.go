@@ -1,30 +1,121 @@
 package squashfs
 
 import (
+	"errors"
 	"io"
+	"io/fs"
+	"strconv"
 	"time"
 
 	"github.com/CalebQ42/squashfs/internal/toreader"
 	squashfslow "github.com/CalebQ42/squashfs/low"
+	"github.com/CalebQ42/squashfs/split"
 )
 
 type Reader struct {
 	FS
-	Low squashfslow.Reader
+	Low    squashfslow.Reader
+	access *accessLog
+	closer io.Closer
 }
 
+// Options used when creating a Reader.
+type ReaderOptions = squashfslow.ReaderOptions
+
 func NewReader(r io.ReaderAt) (Reader, error) {
-	rdr, err := squashfslow.NewReader(r)
+	return NewReaderWithOptions(r, nil)
+}
+
+// Creates a new Reader using the given options. op may be nil.
+func NewReaderWithOptions(r io.ReaderAt, op *ReaderOptions) (Reader, error) {
+	rdr, err := squashfslow.NewReaderWithOptions(r, op)
 	if err != nil {
 		return Reader{}, err
 	}
 	out := Reader{
-		Low: rdr,
+		Low:    rdr,
+		access: &accessLog{files: make(map[string]*FileAccess)},
 	}
 	out.FS = FS{
 		LowDir: rdr.Root,
-		r:   &out,
+		r:      &out,
+	}
+	return out, nil
+}
+
+// Opens the archive at path. On Linux the file is memory mapped, so blocks and metadata that are stored uncompressed
+// are used without being copied.
+//
+// Close must be called once the Reader is no longer used. Blocks returned by the low level readers, such as
+// data.FullReader.Block, may reference the mapped memory and must not be used after Close. Reads started after Close
+// return os.ErrClosed, but Close must not be called while reads, extractions, or WriteTo calls are still running, as
+// they use the mapped memory directly and will crash if it's unmapped underneath them.
+func OpenFile(path string) (Reader, error) {
+	return OpenFileWithOptions(path, nil)
+}
+
+// Same as OpenFile, but using the given options. op may be nil.
+func OpenFileWithOptions(path string, op *ReaderOptions) (Reader, error) {
+	r, closer, err := openMmap(path)
+	if err != nil {
+		return Reader{}, err
 	}
+	out, err := NewReaderWithOptions(r, op)
+	if err != nil {
+		closer.Close()
+		return Reader{}, err
+	}
+	out.closer = closer
+	out.FS.r.closer = closer
+	return out, nil
+}
+
+// Stops any prefetching and closes the archive if it was opened with OpenFile or OpenParts.
+// Readers created with NewReader don't close their io.ReaderAt.
+func (r *Reader) Close() error {
+	r.Low.Close()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Creates a Reader from an archive that's been split into multiple parts. The parts must be in order.
+// Returns an error if the parts are shorter then the archive, or if there are parts after the end of the archive.
+func NewReaderFromParts(parts ...split.Part) (Reader, error) {
+	return newReaderFromSplit(split.New(parts...))
+}
+
+func newReaderFromSplit(sr *split.Reader) (Reader, error) {
+	out, err := NewReader(sr)
+	if err != nil {
+		return out, err
+	}
+	archiveSize := int64(out.Low.Superblock.Size)
+	if sr.Size() < archiveSize {
+		return Reader{}, errors.New("parts are " + strconv.FormatInt(sr.Size(), 10) + " bytes but the archive is " +
+			strconv.FormatInt(archiveSize, 10) + " bytes. a part may be missing")
+	}
+	// Archives are padded to a multiple of 4KiB, so parts starting after that are not part of the archive.
+	if last := sr.PartStart(sr.Parts() - 1); sr.Parts() > 1 && last >= (archiveSize+4095)/4096*4096 {
+		return Reader{}, errors.New("parts continue after the end of the archive. a part may be from a different archive")
+	}
+	return out, nil
+}
+
+// Opens an archive that's been split into multiple files. The files must be given in order. Close closes the files.
+func OpenParts(paths ...string) (Reader, error) {
+	sr, err := split.Open(paths...)
+	if err != nil {
+		return Reader{}, err
+	}
+	out, err := newReaderFromSplit(sr)
+	if err != nil {
+		sr.Close()
+		return Reader{}, err
+	}
+	out.closer = sr
+	out.FS.r.closer = sr
 	return out, nil
 }
 
@@ -35,3 +126,28 @@ func NewReaderAtOffset(r io.ReaderAt, offset int64) (Reader, error) {
 func (r *Reader) ModTime() time.Time {
 	return time.Unix(int64(r.Low.Superblock.ModTime), 0)
 }
+
+// Returns counters of the work done reading the archive. To receive individual operations, set squashfslow.ReaderOptions.Tracer.
+func (r *Reader) Stats() squashfslow.Stats {
+	return r.Low.Stats()
+}
+
+// Opens the file with the given inode number.
+// If the archive doesn't have an export table, the archive is scanned once to find the inode.
+func (r *Reader) OpenInode(num uint32) (*File, error) {
+	p, err := r.Low.PathOf(num)
+	if err != nil {
+		return nil, &fs.PathError{
+			Op:   "open",
+			Path: "inode " + strconv.FormatUint(uint64(num), 10),
+			Err:  err,
+		}
+	}
+	return r.FS.OpenFile(p)
+}
+
+// Returns the full path of the file with the given inode number. The root directory returns ".".
+// If the file is hard linked, only one of it's paths is returned.
+func (r *Reader) PathOf(num uint32) (string, error) {
+	return r.Low.PathOf(num)
+}
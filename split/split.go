@@ -0,0 +1,177 @@
+// Package split provides an io.ReaderAt that presents multiple parts, such as image.sqfs.000, image.sqfs.001, ..., as a single file.
+package split
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A single part of a split file.
+type Part struct {
+	io.ReaderAt
+	Size int64
+}
+
+type part struct {
+	Part
+	start int64
+}
+
+// Reader is an io.ReaderAt over the concatenation of it's parts.
+type Reader struct {
+	parts   []part
+	size    int64
+	closers []io.Closer
+}
+
+// Creates a Reader from the given parts, in order.
+func New(parts ...Part) *Reader {
+	out := &Reader{}
+	for _, p := range parts {
+		out.parts = append(out.parts, part{Part: p, start: out.size})
+		out.size += p.Size
+	}
+	return out
+}
+
+// Opens the files at the given paths as a Reader, in the given order. Close closes the files.
+func Open(paths ...string) (*Reader, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no parts given")
+	}
+	parts := make([]Part, len(paths))
+	var closers []io.Closer
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		closers = append(closers, f)
+		stat, err := f.Stat()
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		parts[i] = Part{ReaderAt: f, Size: stat.Size()}
+	}
+	out := New(parts...)
+	out.closers = closers
+	return out, nil
+}
+
+// Returns the files matching the given filepath.Match pattern, such as "image.sqfs.*", in the order given by SortParts.
+func Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("no parts match " + pattern)
+	}
+	SortParts(matches)
+	return matches, nil
+}
+
+// Sorts part names by their numeric suffix, so image.sqfs.9 comes before image.sqfs.10.
+// Names without a numeric suffix are sorted lexically.
+func SortParts(names []string) {
+	slices.SortFunc(names, func(a, b string) int {
+		aPre, aNum, aOk := numSuffix(a)
+		bPre, bNum, bOk := numSuffix(b)
+		if aOk && bOk && aPre == bPre && aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+func numSuffix(name string) (prefix string, num uint64, ok bool) {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	if i == len(name) {
+		return name, 0, false
+	}
+	num, err := strconv.ParseUint(name[i:], 10, 64)
+	return name[:i], num, err == nil
+}
+
+// The combined size of all parts.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// The number of parts.
+func (r *Reader) Parts() int {
+	return len(r.parts)
+}
+
+// Returns the offset the part at index i starts at.
+func (r *Reader) PartStart(i int) int64 {
+	return r.parts[i].start
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	ind, found := slices.BinarySearchFunc(r.parts, off, func(p part, off int64) int {
+		if p.start < off {
+			return -1
+		} else if p.start > off {
+			return 1
+		}
+		return 0
+	})
+	if !found {
+		ind--
+	}
+	n := 0
+	for ; n < len(p) && ind < len(r.parts); ind++ {
+		pt := r.parts[ind]
+		partOff := off + int64(n) - pt.start
+		toRead := min(int64(len(p)-n), pt.Size-partOff)
+		if toRead <= 0 {
+			continue
+		}
+		red, err := pt.ReadAt(p[n:n+int(toRead)], partOff)
+		n += red
+		if int64(red) < toRead {
+			if err == nil || err == io.EOF {
+				err = errors.New("part " + strconv.Itoa(ind) + " is shorter than it's given size")
+			}
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Closes the parts if they were opened by Open.
+func (r *Reader) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	r.closers = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package split
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadAt(t *testing.T) {
+	dat := make([]byte, 10000)
+	rand.New(rand.NewSource(42)).Read(dat)
+	var parts []Part
+	for start := 0; start < len(dat); {
+		end := min(start+rand.Intn(1500), len(dat))
+		parts = append(parts, Part{ReaderAt: bytes.NewReader(dat[start:end]), Size: int64(end - start)})
+		start = end
+	}
+	r := New(parts...)
+	if r.Size() != int64(len(dat)) {
+		t.Fatal("size is", r.Size(), "should be", len(dat))
+	}
+	for range 1000 {
+		off := rand.Int63n(int64(len(dat)))
+		buf := make([]byte, rand.Intn(3000))
+		n, err := r.ReadAt(buf, off)
+		want := min(len(buf), len(dat)-int(off))
+		if n != want {
+			t.Fatal("read", n, "bytes instead of", want)
+		}
+		if n < len(buf) && err != io.EOF {
+			t.Fatal("short read without io.EOF:", err)
+		} else if n == len(buf) && err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], dat[off:off+int64(n)]) {
+			t.Fatal("data mismatch at offset", off)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	for i := range 12 {
+		name := filepath.Join(dir, "image.sqfs."+string(rune('0'+i/10))+string(rune('0'+i%10)))
+		if i < 10 {
+			name = filepath.Join(dir, "image.sqfs."+string(rune('0'+i)))
+		}
+		err := os.WriteFile(name, []byte{byte(i)}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	got, err := Glob(filepath.Join(dir, "image.sqfs.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatal("parts out of order:", got)
+	}
+	r, err := Open(got...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf := make([]byte, 12)
+	_, err = r.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range buf {
+		if int(b) != i {
+			t.Fatal("part", i, "read as", b)
+		}
+	}
+}
@@ -3,15 +3,25 @@ package squashfs
 //Actually proper tests go here.
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/fs"
+	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -207,3 +217,659 @@ func TestSingleFile(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestExtractLogger(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll("testing/logger")
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rdr.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	globalOut := log.Writer()
+	op := DefaultOptions()
+	op.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	err = f.(*File).ExtractWithOptions("testing/logger", op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Writer() != globalOut {
+		t.Fatal("extraction changed the global logger")
+	}
+	var event struct {
+		Msg   string
+		Op    string
+		Path  string
+		Inode uint32
+	}
+	err = json.Unmarshal(buf.Bytes(), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Op != "extract" || event.Path != filepath.Join("testing/logger", path.Base(filePath)) || event.Inode != f.(*File).Low.Inode.Num {
+		t.Fatal("unexpected log event:", buf.String())
+	}
+}
+
+func TestReadDirPaging(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := rdr.ReadDir(path.Dir(filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rdr.Open(path.Dir(filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := f.(fs.ReadDirFile)
+	first, err := dir.ReadDir(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := dir.ReadDir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paged := append(first, rest...)
+	if len(paged) != len(all) {
+		t.Fatal("paged ReadDir returned", len(paged), "entries, expected", len(all))
+	}
+	for i := range all {
+		if paged[i].Name() != all[i].Name() {
+			t.Fatal("paged ReadDir returned", paged[i].Name(), "expected", all[i].Name())
+		}
+		info, err := all[i].Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Type() != all[i].Type() {
+			t.Fatal("DirEntry type doesn't match it's FileInfo for", all[i].Name())
+		}
+	}
+	_, err = dir.ReadDir(1)
+	if err != io.EOF {
+		t.Fatal("expected io.EOF after reading all entries, got", err)
+	}
+}
+
+func TestFSConformance(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fstest.TestFS(rdr.FS, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := rdr.Sub(path.Dir(filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fstest.TestFS(sub, path.Base(filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := rdr.Glob("**/" + path.Base(filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(matches, filePath) {
+		t.Fatal(filePath, "not matched by ** glob:", matches)
+	}
+	stat, err := rdr.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err = rdr.FindAll(Query{
+		Name:    path.Base(filePath),
+		Types:   TypeRegular,
+		MinSize: stat.Size(),
+		MaxSize: stat.Size(),
+		PermAll: stat.Mode().Perm(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(matches, filePath) {
+		t.Fatal(filePath, "not found:", matches)
+	}
+	matches, err = rdr.FindAll(Query{Path: filePath, Types: TypeDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatal("regular file matched as a directory:", matches)
+	}
+	// Directories don't have a size, so they only match size bounds that allow 0.
+	dir := path.Dir(filePath)
+	matches, err = rdr.FindAll(Query{Path: dir, Types: TypeDir, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(matches, dir) {
+		t.Fatal(dir, "not matched with a MaxSize:", matches)
+	}
+	matches, err = rdr.FindAll(Query{Path: dir, Types: TypeDir, MinSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatal("directory matched with a MinSize:", matches)
+	}
+}
+
+func TestGrep(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := rdr.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _, _ := bytes.Cut(dat, []byte("\n"))
+	if len(line) == 0 {
+		t.Skip(filePath, "starts with an empty line")
+	}
+	var matches []GrepMatch
+	err = rdr.Grep(GrepOptions{Literal: line, Glob: filePath}, func(m GrepMatch) error {
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 || matches[0].Path != filePath || matches[0].Offset != 0 || matches[0].Line != 1 {
+		t.Fatal("unexpected matches:", matches)
+	}
+	if !bytes.Equal(matches[0].Text, line) {
+		t.Fatal("match text doesn't match the line")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := rdr.Manifest(ManifestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := rdr.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(dat)
+	found := false
+	for _, e := range m.Entries {
+		if e.Path == filePath {
+			found = true
+			if !bytes.Equal(e.Hash, want[:]) {
+				t.Fatal("hash of", filePath, "doesn't match")
+			}
+		} else if e.IsDir() && e.Hash != nil {
+			t.Fatal("directory", e.Path, "has a hash")
+		}
+	}
+	if !found {
+		t.Fatal(filePath, "isn't in the manifest")
+	}
+	var buf bytes.Buffer
+	err = m.WriteSums(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), hex.EncodeToString(want[:])+"  "+filePath+"\n") {
+		t.Fatal("sums don't include", filePath)
+	}
+}
+
+func TestMtree(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec bytes.Buffer
+	err = rdr.WriteMtree(&spec, ManifestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := rdr.VerifyMtree(bytes.NewReader(spec.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) > 0 {
+		t.Fatal("image doesn't match it's own spec:", diffs)
+	}
+	spec.WriteString("./not-in-the-image type=file\n")
+	diffs, err = rdr.VerifyMtree(&spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Kind != MtreeMissing || diffs[0].Path != "not-in-the-image" {
+		t.Fatal("unexpected diffs:", diffs)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := rdr.Diff(other.FS, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) > 0 {
+		t.Fatal("archive is different from itself:", diffs)
+	}
+	dir := path.Dir(filePath)
+	if dir == "." {
+		t.Skip(filePath, "isn't in a directory")
+	}
+	sub, err := rdr.Sub(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compared to an empty FS, everything is removed.
+	empty, err := rdr.Sub(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyFS := empty.(FS)
+	emptyFS.LowDir.Entries = nil
+	diffs, err = sub.(FS).Diff(emptyFS, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(diffs, func(d Difference) bool {
+		return d.Kind == DiffRemoved && d.Path == path.Base(filePath)
+	}) {
+		t.Fatal(path.Base(filePath), "wasn't removed:", diffs)
+	}
+}
+
+func TestVerifyDir(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll("testing/verify")
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := path.Dir(filePath)
+	f, err := rdr.OpenFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.ExtractWithOptions("testing/verify", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := rdr.Sub(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Owners can only be set as root.
+	vop := VerifyOptions{IgnoreOwner: true}
+	diffs, err := sub.(FS).VerifyDir("testing/verify", vop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) > 0 {
+		t.Fatal("extracted files are different:", diffs)
+	}
+	extracted := filepath.Join("testing/verify", path.Base(filePath))
+	dat, err := os.ReadFile(extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dat) == 0 {
+		t.Skip(filePath, "is empty")
+	}
+	info, err := os.Stat(extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat[0]++
+	err = os.WriteFile(extracted, dat, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(extracted, info.ModTime(), info.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = sub.(FS).VerifyDir("testing/verify", vop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Changes != ChangeContent {
+		t.Fatal("unexpected differences:", diffs)
+	}
+}
+
+func TestOpenInode(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rdr.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := rdr.PathOf(f.Low.Inode.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filePath {
+		t.Fatal("PathOf returned", path, "instead of", filePath)
+	}
+	byNum, err := rdr.OpenInode(f.Low.Inode.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := byNum.Parent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err = rdr.PathOf(parent.Low.Inode.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Dir(filePath) {
+		t.Fatal("Parent returned", path, "instead of", filepath.Dir(filePath))
+	}
+	// Files opened from a Sub FS don't know the directories above the Sub.
+	sub, err := rdr.Sub(filepath.Dir(filepath.Dir(filePath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromSub, err := sub.(FS).OpenFile(filepath.Join(filepath.Base(filepath.Dir(filePath)), filepath.Base(filePath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err = fromSub.Parent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grand, err := parent.Parent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err = rdr.PathOf(grand.Low.Inode.Num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Dir(filepath.Dir(filePath)) {
+		t.Fatal("Parent of a file from a Sub returned", path, "instead of", filepath.Dir(filepath.Dir(filePath)))
+	}
+}
+
+func TestSortFile(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr.RecordAccess(true)
+	_, err = rdr.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = rdr.WriteSortFile(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != filePath+" 32767\n" {
+		t.Fatal("unexpected sort file:", buf.String())
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fil.Close()
+	rdr, err := OpenFile(filepath.Join(tmpDir, squashfsName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	f, err := rdr.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := f.Stat()
+	if int64(buf.Len()) != stat.Size() {
+		t.Fatal("read", buf.Len(), "bytes instead of", stat.Size())
+	}
+}
+
+func TestReadAfterClose(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fil.Close()
+	rdr, err := OpenFile(filepath.Join(tmpDir, squashfsName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rdr.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rdr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current block was already read, so it's still available. Later blocks can't be read.
+	_, err = io.ReadAll(f)
+	if stat.Size() > int64(rdr.Low.Superblock.BlockSize) && !errors.Is(err, os.ErrClosed) {
+		t.Fatal("reading after Close returned", err, "instead of os.ErrClosed")
+	}
+	_, err = rdr.Open(filePath)
+	if !errors.Is(err, os.ErrClosed) {
+		t.Fatal("opening after Close returned", err, "instead of os.ErrClosed")
+	}
+}
+
+func TestSeek(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(fil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file spanning multiple blocks.
+	paths, err := rdr.FindAll(Query{Types: TypeRegular, MinSize: 3 * int64(rdr.Low.Superblock.BlockSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("no file large enough")
+	}
+	want, err := rdr.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := rdr.OpenFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 1000)
+	for _, off := range []int64{int64(len(want)) - 10, 0, int64(rdr.Low.Superblock.BlockSize) - 500, int64(len(want)) / 2} {
+		pos, err := f.Seek(off, io.SeekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != off {
+			t.Fatal("seeked to", pos, "instead of", off)
+		}
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], want[off:min(off+1000, int64(len(want)))]) {
+			t.Fatal("data mismatch at offset", off)
+		}
+	}
+	pos, err := f.Seek(-100, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != int64(len(want))-100 {
+		t.Fatal("seeked to", pos, "instead of", len(want)-100)
+	}
+	pos, _ = f.Seek(50, io.SeekCurrent)
+	if pos != int64(len(want))-50 {
+		t.Fatal("seeked to", pos, "instead of", len(want)-50)
+	}
+	// io.Copy uses WriteTo, which must start at the current position and leave the position at the end.
+	_, err = f.Seek(1, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	_, err = io.Copy(&out, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want[1:]) {
+		t.Fatal("copy after seeking to 1 returned", out.Len(), "bytes that don't match the file's data after offset 1")
+	}
+	n, err := f.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatal("read after copying returned", n, err, "instead of io.EOF")
+	}
+	g, err := rdr.OpenFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	out.Reset()
+	_, err = io.Copy(&out, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Fatal("copying an unread file returned different data")
+	}
+	n, err = g.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatal("read after copying returned", n, err, "instead of io.EOF")
+	}
+}
+
+func TestExtractStream(t *testing.T) {
+	tmpDir := "testing"
+	fil, err := preTest(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fil.Close()
+	path := filepath.Join(tmpDir, "streamExtract")
+	os.RemoveAll(path)
+	op := DefaultStreamOptions()
+	op.TempDir = tmpDir
+	err = ExtractStream(fil, path, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(path, filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,367 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/CalebQ42/squashfs/internal/fileattr"
+	squashfslow "github.com/CalebQ42/squashfs/low"
+)
+
+// Options for ExtractStream.
+type StreamOptions struct {
+	// The options used for extraction. Defaults to DefaultOptions().
+	Extraction *ExtractionOptions
+	// The directory spooled file data is stored in once MemoryLimit is reached. Defaults to a hidden directory in the
+	// folder being extracted to, so the spool is on the same filesystem as the extracted files.
+	TempDir string
+	// The amount of spooled file data kept in memory. The tables at the end of the archive are always kept in memory.
+	// Defaults to 64MiB.
+	MemoryLimit int64
+	// The largest archive that will be spooled. If the archive is larger, ExtractStream fails before reading past the superblock.
+	// 0 means there's no limit.
+	MaxSpool int64
+	// The size of the pieces the spool is stored and released in. Defaults to 4MiB.
+	ChunkSize int64
+}
+
+func DefaultStreamOptions() *StreamOptions {
+	return &StreamOptions{
+		Extraction:  DefaultOptions(),
+		MemoryLimit: 64 * 1024 * 1024,
+		ChunkSize:   4 * 1024 * 1024,
+	}
+}
+
+// Extracts an archive from a non-seekable stream, such as stdin or a tar entry, to folder. If op is nil, DefaultStreamOptions is used.
+//
+// A squashfs archive's inode and directory tables are stored after the file data. Until they're read, neither the files'
+// boundaries nor the sizes of their compressed blocks are known, so no data can be placed until the entire archive has been
+// read. The file data is spooled, first to memory and then to op.TempDir, while it's read, and the tables are kept in memory.
+// Files are then extracted in the order their data is stored and the spool is released as it's no longer needed.
+//
+// This does not keep peak temporary storage far below the size of the archive. Before anything is extracted, the spool
+// holds nearly all of the archive's file data, so op.TempDir needs about as much free space as the archive itself.
+func ExtractStream(r io.Reader, folder string, op *StreamOptions) error {
+	def := DefaultStreamOptions()
+	if op == nil {
+		op = def
+	}
+	sop := *op
+	if sop.Extraction == nil {
+		sop.Extraction = def.Extraction
+	}
+	if sop.MemoryLimit <= 0 {
+		sop.MemoryLimit = def.MemoryLimit
+	}
+	if sop.ChunkSize <= 0 {
+		sop.ChunkSize = def.ChunkSize
+	}
+	head := make([]byte, 96)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return errors.Join(errors.New("failed to read superblock"), err)
+	}
+	if binary.LittleEndian.Uint32(head) != 0x73717368 {
+		return squashfslow.ErrorMagic
+	}
+	size := int64(binary.LittleEndian.Uint64(head[40:]))
+	if size < 96 {
+		return errors.New("invalid archive size in superblock")
+	}
+	if sop.MaxSpool > 0 && size > sop.MaxSpool {
+		return errors.New("archive is " + strconv.FormatInt(size, 10) + " bytes, which is larger then MaxSpool")
+	}
+	if sop.TempDir == "" {
+		err = os.MkdirAll(folder, 0755)
+		if err != nil {
+			return err
+		}
+		sop.TempDir = folder
+	}
+	tableStart := int64(binary.LittleEndian.Uint64(head[64:]))
+	if tableStart < 96 || tableStart > size {
+		tableStart = size
+	}
+	sp := &spool{op: &sop, tableStart: tableStart}
+	defer sp.Close()
+	err = sp.fill(io.MultiReader(bytes.NewReader(head), io.LimitReader(r, size-96)))
+	if err != nil {
+		return errors.Join(errors.New("failed to spool archive"), err)
+	}
+	if sp.size != size {
+		return errors.New("stream ended after " + strconv.FormatInt(sp.size, 10) + " bytes, but the archive is " +
+			strconv.FormatInt(size, 10) + " bytes")
+	}
+	rdr, err := NewReader(sp)
+	if err != nil {
+		return err
+	}
+	return rdr.extractSpooled(sp, folder, sop.Extraction)
+}
+
+type streamItem struct {
+	path    string
+	b       squashfslow.FileBase
+	regions []squashfslow.Region
+}
+
+func (r *Reader) extractSpooled(sp *spool, folder string, op *ExtractionOptions) error {
+	dirs := map[string]FS{".": r.FS}
+	var dirItems, others, regular []streamItem
+	err := r.Low.Walk(func(p string, b squashfslow.FileBase) error {
+		it := streamItem{path: p, b: b}
+		switch {
+		case b.IsDir():
+			if p != "." {
+				d, err := b.ToDir(r.Low)
+				if err != nil {
+					return err
+				}
+				dirs[p] = r.FSFromDirectory(d, dirs[path.Dir(p)])
+			}
+			dirItems = append(dirItems, it)
+		case b.IsRegular():
+			var err error
+			it.regions, err = b.DataRegions(&r.Low)
+			if err != nil {
+				return err
+			}
+			regular = append(regular, it)
+		default:
+			others = append(others, it)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range dirItems {
+		err = os.MkdirAll(filepath.Join(folder, filepath.FromSlash(d.path)), 0777)
+		if err != nil {
+			return errors.Join(errors.New("failed to create directory: "+d.path), err)
+		}
+	}
+	var errs []error
+	extract := func(it streamItem) {
+		fil := r.FileFromBase(it.b, dirs[path.Dir(it.path)])
+		err := fil.ExtractWithOptions(filepath.Join(folder, filepath.FromSlash(path.Dir(it.path))), op)
+		fil.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Symlinks may need the data of other files, so they're extracted before any of the spool is released.
+	for _, it := range others {
+		extract(it)
+	}
+	// The spool is only released in the data region. The tables after it are always kept.
+	keepFrom := int(r.Low.Superblock.InodeTableStart / uint64(sp.op.ChunkSize))
+	refs := make([]int, len(sp.chunks))
+	chunks := func(reg squashfslow.Region) (int, int) {
+		return int(reg.Start / uint64(sp.op.ChunkSize)), int((reg.End - 1) / uint64(sp.op.ChunkSize))
+	}
+	for _, it := range regular {
+		for _, reg := range it.regions {
+			first, last := chunks(reg)
+			for c := first; c <= last; c++ {
+				refs[c]++
+			}
+		}
+	}
+	for c := range min(keepFrom, len(refs)) {
+		if refs[c] == 0 {
+			sp.release(c)
+		}
+	}
+	slices.SortStableFunc(regular, func(a, b streamItem) int {
+		var aStart, bStart uint64
+		if len(a.regions) > 0 {
+			aStart = a.regions[0].Start
+		}
+		if len(b.regions) > 0 {
+			bStart = b.regions[0].Start
+		}
+		if aStart < bStart {
+			return -1
+		} else if aStart > bStart {
+			return 1
+		}
+		return 0
+	})
+	for _, it := range regular {
+		extract(it)
+		for _, reg := range it.regions {
+			first, last := chunks(reg)
+			for c := first; c <= last; c++ {
+				refs[c]--
+				if refs[c] == 0 && c < keepFrom {
+					sp.release(c)
+				}
+			}
+		}
+	}
+	// Directory permissions and times are set last, deepest first, so read-only directories don't prevent extracting
+	// their contents and extracting their contents doesn't change their modification times.
+	for i := len(dirItems) - 1; i >= 0; i-- {
+		d := dirItems[i]
+		p := filepath.Join(folder, filepath.FromSlash(d.path))
+		if !op.IgnorePerm {
+			uid, err := d.b.Uid(&r.Low)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			gid, err := d.b.Gid(&r.Low)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fileattr.SetPerm(p, d.b.Inode, int(uid), int(gid))
+		}
+		err = fileattr.SetModTime(p, d.b.Inode)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errors.New("failed to extract stream"), errors.Join(errs...))
+	}
+	return nil
+}
+
+// Holds a stream's data, first in memory then in temporary files. Chunks starting at or after tableStart hold the archive's
+// tables and are always kept in memory.
+type spool struct {
+	op         *StreamOptions
+	mut        sync.RWMutex
+	chunks     []spoolChunk
+	size       int64
+	memUsed    int64
+	tableStart int64
+	dir        string
+}
+
+type spoolChunk struct {
+	mem      []byte
+	fil      *os.File
+	released bool
+}
+
+func (s *spool) fill(r io.Reader) error {
+	for {
+		buf := make([]byte, s.op.ChunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			storeErr := s.store(buf[:n])
+			if storeErr != nil {
+				return storeErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *spool) store(dat []byte) error {
+	if s.size >= s.tableStart {
+		s.chunks = append(s.chunks, spoolChunk{mem: dat})
+		s.size += int64(len(dat))
+		return nil
+	}
+	if s.memUsed+int64(len(dat)) <= s.op.MemoryLimit {
+		s.chunks = append(s.chunks, spoolChunk{mem: dat})
+		s.memUsed += int64(len(dat))
+		s.size += int64(len(dat))
+		return nil
+	}
+	if s.dir == "" {
+		var err error
+		s.dir, err = os.MkdirTemp(s.op.TempDir, ".squashfs-spool-")
+		if err != nil {
+			return err
+		}
+	}
+	fil, err := os.Create(filepath.Join(s.dir, strconv.Itoa(len(s.chunks))))
+	if err != nil {
+		return err
+	}
+	_, err = fil.Write(dat)
+	if err != nil {
+		fil.Close()
+		return err
+	}
+	s.chunks = append(s.chunks, spoolChunk{fil: fil})
+	s.size += int64(len(dat))
+	return nil
+}
+
+func (s *spool) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	n := 0
+	for n < len(p) {
+		cur := off + int64(n)
+		if cur >= s.size {
+			return n, io.EOF
+		}
+		idx := cur / s.op.ChunkSize
+		chunkOff := cur - idx*s.op.ChunkSize
+		c := s.chunks[idx]
+		if c.released {
+			return n, errors.New("spooled data at offset " + strconv.FormatInt(cur, 10) + " was already released")
+		}
+		toRead := min(int64(len(p)-n), s.op.ChunkSize-chunkOff, s.size-cur)
+		if c.mem != nil {
+			n += copy(p[n:n+int(toRead)], c.mem[chunkOff:])
+			continue
+		}
+		red, err := c.fil.ReadAt(p[n:n+int(toRead)], chunkOff)
+		n += red
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Frees the chunk at i.
+func (s *spool) release(i int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	c := &s.chunks[i]
+	if c.released {
+		return
+	}
+	c.released = true
+	c.mem = nil
+	if c.fil != nil {
+		c.fil.Close()
+		os.Remove(c.fil.Name())
+		c.fil = nil
+	}
+}
+
+func (s *spool) Close() error {
+	for i := range s.chunks {
+		s.release(i)
+	}
+	if s.dir != "" {
+		return os.RemoveAll(s.dir)
+	}
+	return nil
+}
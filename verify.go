@@ -0,0 +1,297 @@
+package squashfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/CalebQ42/squashfs/low/inode"
+)
+
+var errContentDiffers = errors.New("content differs")
+
+// Options for FS.VerifyDir.
+type VerifyOptions struct {
+	// Don't compare uids and gids. Owners are never compared on systems without them, such as Windows.
+	IgnoreOwner bool
+	// Don't compare modification times.
+	IgnoreModTime bool
+	// Don't compare permissions, such as when extracted with ExtractionOptions.IgnorePerm.
+	IgnorePerm bool
+	// Compare regular files by their size and modification time instead of their contents.
+	Fast bool
+	// The number of files whose contents are compared at once. Defaults to runtime.NumCPU().
+	Routines int
+}
+
+// Compares the FS to a directory on disk, such as one the FS was extracted to. Returns a Difference for every file that's
+// different, in the same order as fs.WalkDir. Files in the FS that are missing from the directory are DiffRemoved, extra
+// files in the directory are DiffAdded. For changed files, Old is the file in the FS and New is the file on disk.
+//
+// Regular files' contents are compared directly against the FS's data, concurrently, unless op.Fast is set.
+// Symlinks' permissions, owners, and modification times aren't compared, since they usually can't be set.
+// Sockets are ignored since they aren't extracted.
+func (f FS) VerifyDir(dir string, op VerifyOptions) ([]Difference, error) {
+	if op.Routines <= 0 {
+		op.Routines = runtime.NumCPU()
+	}
+	entries, err := f.manifestEntries(Query{Types: TypeRegular | TypeDir | TypeSymlink | TypeDevice | TypeFifo})
+	if err != nil {
+		return nil, err
+	}
+	v := &verifier{f: f, dir: dir, op: op}
+	inFS := make(map[string]bool, len(entries))
+	// Directories that aren't directories on disk. Their contents are missing.
+	var missing []string
+	for _, e := range entries {
+		inFS[e.Path] = true
+		if slices.ContainsFunc(missing, func(m string) bool { return strings.HasPrefix(e.Path, m+"/") }) {
+			v.out = append(v.out, Difference{Path: e.Path, Kind: DiffRemoved, Old: e.FileInfo})
+			continue
+		}
+		isDir, err := v.compare(e)
+		if err != nil {
+			return nil, err
+		}
+		if e.IsDir() && !isDir {
+			missing = append(missing, e.Path)
+		}
+	}
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." || inFS[rel] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		disk, _ := diskInfo(p, info)
+		v.out = append(v.out, Difference{Path: rel, Kind: DiffAdded, New: disk})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = v.compareContents()
+	if err != nil {
+		return nil, err
+	}
+	out := slices.DeleteFunc(v.out, func(d Difference) bool {
+		return d.Kind == DiffChanged && d.Changes == 0
+	})
+	slices.SortStableFunc(out, func(a, b Difference) int {
+		return comparePaths(a.Path, b.Path)
+	})
+	return out, nil
+}
+
+type verifier struct {
+	f   FS
+	dir string
+	op  VerifyOptions
+	out []Difference
+	// Indexes in out of regular files whose contents need to be compared, and the entries.
+	toCompare []int
+	entries   []ManifestEntry
+}
+
+// Compares the entry to the file on disk. Returns whether the file is a directory on disk.
+func (v *verifier) compare(e ManifestEntry) (bool, error) {
+	p := filepath.Join(v.dir, filepath.FromSlash(e.Path))
+	info, err := os.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		v.out = append(v.out, Difference{Path: e.Path, Kind: DiffRemoved, Old: e.FileInfo})
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	disk, dev := diskInfo(p, info)
+	diff := Difference{Path: e.Path, Kind: DiffChanged, Old: e.FileInfo, New: disk}
+	if baseType(e.fileType) != disk.fileType {
+		diff.Changes = ChangeType
+		v.out = append(v.out, diff)
+		return disk.IsDir(), nil
+	}
+	_, _, _, hasOwner := diskOwner(info)
+	symlink := e.IsSymlink()
+	if !v.op.IgnorePerm && !symlink && e.Perm() != disk.perm {
+		diff.Changes |= ChangeMode
+	}
+	if !v.op.IgnoreOwner && hasOwner && !symlink && (e.uid != disk.uid || e.gid != disk.gid) {
+		diff.Changes |= ChangeOwner
+	}
+	if !v.op.IgnoreModTime && !symlink && e.modTime != disk.modTime {
+		diff.Changes |= ChangeModTime
+	}
+	if e.target != disk.target {
+		diff.Changes |= ChangeTarget
+	}
+	if (e.fileType == inode.Block || e.fileType == inode.Char || e.fileType == inode.EBlock || e.fileType == inode.EChar) &&
+		runtime.GOOS == "linux" && hasOwner {
+		b, err := e.d.base()
+		if err != nil {
+			return true, &fs.PathError{Op: "verify", Path: e.Path, Err: err}
+		}
+		if deviceNum(b.Inode) != dev {
+			diff.Changes |= ChangeDevice
+		}
+	}
+	v.out = append(v.out, diff)
+	if e.fileType == inode.Fil || e.fileType == inode.EFil {
+		if e.size != disk.size {
+			v.out[len(v.out)-1].Changes |= ChangeContent
+		} else if !v.op.Fast {
+			v.toCompare = append(v.toCompare, len(v.out)-1)
+			v.entries = append(v.entries, e)
+		}
+	}
+	return disk.IsDir(), nil
+}
+
+// Returns a FileInfo of a file on disk, and it's device number if it's a device on Linux.
+func diskInfo(p string, info fs.FileInfo) (FileInfo, uint32) {
+	out := FileInfo{
+		name:    info.Name(),
+		size:    info.Size(),
+		perm:    uint32(info.Mode().Perm()),
+		modTime: uint32(info.ModTime().Unix()),
+		links:   1,
+	}
+	if info.Mode()&fs.ModeSetuid != 0 {
+		out.perm |= 0o4000
+	}
+	if info.Mode()&fs.ModeSetgid != 0 {
+		out.perm |= 0o2000
+	}
+	if info.Mode()&fs.ModeSticky != 0 {
+		out.perm |= 0o1000
+	}
+	var dev uint32
+	out.uid, out.gid, dev, _ = diskOwner(info)
+	switch info.Mode().Type() {
+	case fs.ModeDir:
+		out.fileType = inode.Dir
+		out.size = 0
+	case fs.ModeSymlink:
+		out.fileType = inode.Sym
+		out.target, _ = os.Readlink(p)
+		out.size = 0
+	case fs.ModeDevice:
+		out.fileType = inode.Block
+	case fs.ModeDevice | fs.ModeCharDevice:
+		out.fileType = inode.Char
+	case fs.ModeNamedPipe:
+		out.fileType = inode.Fifo
+	case fs.ModeSocket:
+		out.fileType = inode.Sock
+	default:
+		out.fileType = inode.Fil
+	}
+	return out, dev
+}
+
+// Compares the contents of regular files that are the same size.
+func (v *verifier) compareContents() error {
+	var (
+		wg   sync.WaitGroup
+		mut  sync.Mutex
+		errs []error
+	)
+	work := make(chan int)
+	for range v.op.Routines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				e := v.entries[i]
+				same, err := v.sameContents(e)
+				mut.Lock()
+				if err != nil {
+					errs = append(errs, &fs.PathError{Op: "verify", Path: e.Path, Err: err})
+				} else if !same {
+					v.out[v.toCompare[i]].Changes |= ChangeContent
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	for i := range v.toCompare {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (v *verifier) sameContents(e ManifestEntry) (bool, error) {
+	fil, err := os.Open(filepath.Join(v.dir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return false, err
+	}
+	defer fil.Close()
+	b, err := e.d.base()
+	if err != nil {
+		return false, err
+	}
+	full, err := b.GetFullReader(&v.f.r.Low)
+	if err != nil {
+		return false, err
+	}
+	defer full.Close()
+	_, err = full.WriteTo(&compareWriter{r: fil})
+	if errors.Is(err, errContentDiffers) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Compares the data written to it against r. Returns errContentDiffers once they're different.
+type compareWriter struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (c *compareWriter) Write(p []byte) (int, error) {
+	if cap(c.buf) < len(p) {
+		c.buf = make([]byte, len(p))
+	}
+	buf := c.buf[:len(p)]
+	_, err := io.ReadFull(c.r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, errContentDiffers
+	} else if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(p, buf) {
+		return 0, errContentDiffers
+	}
+	return len(p), nil
+}
+
+// Compares slash separated paths component by component, giving the same order as fs.WalkDir.
+func comparePaths(a, b string) int {
+	for a != "" || b != "" {
+		var aPart, bPart string
+		aPart, a, _ = strings.Cut(a, "/")
+		bPart, b, _ = strings.Cut(b, "/")
+		if c := strings.Compare(aPart, bPart); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package squashfs
+
+import "io/fs"
+
+// File owners aren't available outside of unix systems.
+func diskOwner(fi fs.FileInfo) (uid, gid, dev uint32, ok bool) {
+	return 0, 0, 0, false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package squashfs
+
+import (
+	"io/fs"
+	"runtime"
+	"syscall"
+)
+
+// Returns the owner of a file on disk and, on Linux, it's device number encoded the same as squashfs.
+func diskOwner(fi fs.FileInfo) (uid, gid, dev uint32, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	if runtime.GOOS == "linux" {
+		rdev := uint64(st.Rdev)
+		major := uint32((rdev>>8)&0xfff | (rdev>>32)&^0xfff)
+		minor := uint32(rdev&0xff | (rdev>>12)&^0xff)
+		dev = minor&0xff | major<<8 | (minor&^0xff)<<12
+	}
+	return st.Uid, st.Gid, dev, true
+}